@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
+)
+
+const (
+	// defaultClientCacheSize is the maximum number of Graph clients kept by default
+	defaultClientCacheSize = 64
+	// defaultClientCacheIdleTTL is how long an unused Graph client is kept by default
+	defaultClientCacheIdleTTL = 30 * time.Minute
+)
+
+// graphClientCache keeps Microsoft Graph clients alive across RunFunction calls.
+// Each client holds on to its Azure credential, whose in-memory token cache only
+// hands out tokens until they are about to expire, so reusing a client avoids
+// a new token acquisition per reconcile. The zero value is ready to use.
+type graphClientCache struct {
+	mu      sync.Mutex
+	entries map[string]*graphClientCacheEntry
+
+	// maxEntries bounds the cache size, least recently used clients are evicted first
+	maxEntries int
+	// idleTTL is how long a client may go unused before it is evicted
+	idleTTL time.Duration
+	// now returns the current time, it is overridden in tests
+	now func() time.Time
+}
+
+// graphClientCacheEntry is a cached Graph client and the time it was last handed out
+type graphClientCacheEntry struct {
+	client   *msgraphsdk.GraphServiceClient
+	lastUsed time.Time
+}
+
+// graphClientCacheKey hashes the credentials so that secrets are not kept as map keys
+func graphClientCacheKey(azureCreds map[string]string) string {
+	keys := make([]string, 0, len(azureCreds))
+	for k := range azureCreds {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write([]byte(azureCreds[k]))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// get returns the cached client for the key, if it has not been idle for too long
+func (c *graphClientCache) get(key string) (*msgraphsdk.GraphServiceClient, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.timeNow()
+	c.evictIdle(now)
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry.lastUsed = now
+	return entry.client, true
+}
+
+// add caches the client for the key, evicting the least recently used client if the cache is full
+func (c *graphClientCache) add(key string, client *msgraphsdk.GraphServiceClient) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]*graphClientCacheEntry)
+	}
+
+	now := c.timeNow()
+	c.evictIdle(now)
+
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.size() {
+		c.evictLeastRecentlyUsed()
+	}
+	c.entries[key] = &graphClientCacheEntry{client: client, lastUsed: now}
+}
+
+// evictIdle removes every client that has not been used within the idle TTL
+func (c *graphClientCache) evictIdle(now time.Time) {
+	idleTTL := c.idleTTL
+	if idleTTL == 0 {
+		idleTTL = defaultClientCacheIdleTTL
+	}
+	for key, entry := range c.entries {
+		if now.Sub(entry.lastUsed) > idleTTL {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// evictLeastRecentlyUsed removes the client that was used the longest time ago
+func (c *graphClientCache) evictLeastRecentlyUsed() {
+	var (
+		oldestKey  string
+		oldestUsed time.Time
+	)
+	for key, entry := range c.entries {
+		if oldestKey == "" || entry.lastUsed.Before(oldestUsed) {
+			oldestKey, oldestUsed = key, entry.lastUsed
+		}
+	}
+	delete(c.entries, oldestKey)
+}
+
+func (c *graphClientCache) size() int {
+	if c.maxEntries > 0 {
+		return c.maxEntries
+	}
+	return defaultClientCacheSize
+}
+
+func (c *graphClientCache) timeNow() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
+)
+
+func TestGraphClientCacheKey(t *testing.T) {
+	creds := map[string]string{"tenantId": "t", "clientId": "c", "clientSecret": "s"}
+	same := map[string]string{"clientSecret": "s", "clientId": "c", "tenantId": "t"}
+	rotated := map[string]string{"tenantId": "t", "clientId": "c", "clientSecret": "s2"}
+
+	if graphClientCacheKey(creds) != graphClientCacheKey(same) {
+		t.Errorf("graphClientCacheKey(...): equal credentials should hash to the same key")
+	}
+	if graphClientCacheKey(creds) == graphClientCacheKey(rotated) {
+		t.Errorf("graphClientCacheKey(...): a rotated secret should hash to a different key")
+	}
+}
+
+func TestGraphClientCache(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	a, b, c := &msgraphsdk.GraphServiceClient{}, &msgraphsdk.GraphServiceClient{}, &msgraphsdk.GraphServiceClient{}
+
+	type want struct {
+		a, b, c bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		run    func(cache *graphClientCache)
+		want   want
+	}{
+		"Hit": {
+			reason: "A cached client should be returned",
+			run: func(cache *graphClientCache) {
+				cache.add("a", a)
+			},
+			want: want{a: true},
+		},
+		"IdleEviction": {
+			reason: "A client unused for longer than the idle TTL should be evicted",
+			run: func(cache *graphClientCache) {
+				cache.add("a", a)
+				now = now.Add(2 * time.Minute)
+				cache.add("b", b)
+			},
+			want: want{b: true},
+		},
+		"UseKeepsClientAlive": {
+			reason: "Using a client should reset its idle time",
+			run: func(cache *graphClientCache) {
+				cache.add("a", a)
+				now = now.Add(50 * time.Second)
+				cache.get("a")
+				now = now.Add(50 * time.Second)
+			},
+			want: want{a: true},
+		},
+		"LeastRecentlyUsedEviction": {
+			reason: "The least recently used client should be evicted when the cache is full",
+			run: func(cache *graphClientCache) {
+				cache.add("a", a)
+				now = now.Add(time.Second)
+				cache.add("b", b)
+				now = now.Add(time.Second)
+				cache.get("a")
+				now = now.Add(time.Second)
+				cache.add("c", c)
+			},
+			want: want{a: true, c: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cache := &graphClientCache{maxEntries: 2, idleTTL: time.Minute, now: clock}
+			tc.run(cache)
+
+			got := want{}
+			if client, ok := cache.get("a"); ok && client == a {
+				got.a = true
+			}
+			if client, ok := cache.get("b"); ok && client == b {
+				got.b = true
+			}
+			if client, ok := cache.get("c"); ok && client == c {
+				got.c = true
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("%s\ngraphClientCache: -want cached, +got cached:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGraphClientCacheConcurrentAccess(t *testing.T) {
+	cache := &graphClientCache{maxEntries: 4}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("key-%d", i%8)
+			if _, ok := cache.get(key); !ok {
+				cache.add(key, &msgraphsdk.GraphServiceClient{})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := len(cache.entries); got > 4 {
+		t.Errorf("graphClientCache: want at most 4 entries, got %d", got)
+	}
+}
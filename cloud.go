@@ -0,0 +1,70 @@
+package main
+
+import (
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+)
+
+// Supported values for the cloud field of the azure-creds credentials
+const (
+	cloudAzurePublic       = "AzurePublicCloud"
+	cloudAzureUSGovernment = "AzureUSGovernment"
+	cloudAzureChina        = "AzureChinaCloud"
+)
+
+// retiredClouds maps the names of retired national clouds to the reason they are not supported
+var retiredClouds = map[string]string{
+	// Microsoft Cloud Deutschland was closed in October 2021, its tenants were moved to the public cloud
+	"AzureGermanyCloud": "Microsoft Cloud Deutschland was retired, use AzurePublicCloud",
+}
+
+// graphCloud pairs the Microsoft Entra ID authority of a national cloud with its Microsoft Graph endpoint
+type graphCloud struct {
+	authority     cloud.Configuration
+	graphEndpoint string
+}
+
+// graphClouds maps every supported cloud name to its endpoints
+// See: https://learn.microsoft.com/en-us/graph/deployments
+var graphClouds = map[string]graphCloud{
+	cloudAzurePublic: {
+		authority:     cloud.AzurePublic,
+		graphEndpoint: "https://graph.microsoft.com",
+	},
+	cloudAzureUSGovernment: {
+		authority:     cloud.AzureGovernment,
+		graphEndpoint: "https://graph.microsoft.us",
+	},
+	cloudAzureChina: {
+		authority:     cloud.AzureChina,
+		graphEndpoint: "https://microsoftgraph.chinacloudapi.cn",
+	},
+}
+
+// getGraphCloud returns the cloud selected by the credentials, defaulting to the public cloud
+func getGraphCloud(azureCreds map[string]string) (graphCloud, error) {
+	name := azureCreds["cloud"]
+	if name == "" {
+		name = cloudAzurePublic
+	}
+
+	if reason, ok := retiredClouds[name]; ok {
+		return graphCloud{}, errors.Errorf("unsupported cloud: %s: %s", name, reason)
+	}
+	c, ok := graphClouds[name]
+	if !ok {
+		return graphCloud{}, errors.Errorf("unsupported cloud: %s", name)
+	}
+	return c, nil
+}
+
+// baseURL returns the Microsoft Graph v1.0 base URL of the cloud
+func (c graphCloud) baseURL() string {
+	return c.graphEndpoint + "/v1.0"
+}
+
+// scope returns the token scope granting access to Microsoft Graph in the cloud
+func (c graphCloud) scope() string {
+	return c.graphEndpoint + "/.default"
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGraphClouds(t *testing.T) {
+	type want struct {
+		authorityHost string
+		baseURL       string
+		scope         string
+	}
+
+	cases := map[string]struct {
+		reason string
+		cloud  string
+		want   want
+	}{
+		"Default": {
+			reason: "Without a cloud the public cloud should be used",
+			want: want{
+				authorityHost: "login.microsoftonline.com",
+				baseURL:       "https://graph.microsoft.com/v1.0",
+				scope:         "https://graph.microsoft.com/.default",
+			},
+		},
+		"AzureUSGovernment": {
+			reason: "The US Government cloud should use its own authority and Graph endpoint",
+			cloud:  "AzureUSGovernment",
+			want: want{
+				authorityHost: "login.microsoftonline.us",
+				baseURL:       "https://graph.microsoft.us/v1.0",
+				scope:         "https://graph.microsoft.us/.default",
+			},
+		},
+		"AzureChinaCloud": {
+			reason: "The China cloud should use its own authority and Graph endpoint",
+			cloud:  "AzureChinaCloud",
+			want: want{
+				authorityHost: "login.chinacloudapi.cn",
+				baseURL:       "https://microsoftgraph.chinacloudapi.cn/v1.0",
+				scope:         "https://microsoftgraph.chinacloudapi.cn/.default",
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			azureCreds := map[string]string{
+				"tenantId":     "test-tenant-id",
+				"clientId":     "test-client-id",
+				"clientSecret": "test-client-secret",
+				"cloud":        tc.cloud,
+			}
+
+			gc, err := getGraphCloud(azureCreds)
+			if err != nil {
+				t.Fatalf("%s\ngetGraphCloud(...): unexpected error: %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want.scope, gc.scope()); diff != "" {
+				t.Errorf("%s\nscope(): -want, +got:\n%s", tc.reason, diff)
+			}
+
+			endpoint := newFakeTokenEndpoint(t)
+			g := &GraphQuery{clientOptions: endpoint.clientOptions()}
+
+			cred, err := g.newTokenCredential(azureCreds)
+			if err != nil {
+				t.Fatalf("%s\nnewTokenCredential(...): unexpected error: %v", tc.reason, err)
+			}
+			if _, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{Scopes: []string{gc.scope()}}); err != nil {
+				t.Fatalf("%s\nGetToken(...): unexpected error: %v", tc.reason, err)
+			}
+			if len(endpoint.hosts) == 0 {
+				t.Fatalf("%s\nfake token endpoint: no token requests received", tc.reason)
+			}
+			if diff := cmp.Diff(tc.want.authorityHost, endpoint.hosts[0]); diff != "" {
+				t.Errorf("%s\nauthority host: -want, +got:\n%s", tc.reason, diff)
+			}
+
+			client, err := g.createGraphClient(azureCreds)
+			if err != nil {
+				t.Fatalf("%s\ncreateGraphClient(...): unexpected error: %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want.baseURL, client.GetAdapter().GetBaseUrl()); diff != "" {
+				t.Errorf("%s\nGraph base URL: -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetGraphCloudUnsupported(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		cloud  string
+		want   string
+	}{
+		"AzureGermanyCloud": {
+			reason: "The retired German cloud should fail with an error saying it was retired",
+			cloud:  "AzureGermanyCloud",
+			want:   "unsupported cloud: AzureGermanyCloud: Microsoft Cloud Deutschland was retired, use AzurePublicCloud",
+		},
+		"Unknown": {
+			reason: "An unknown cloud should fail",
+			cloud:  "AzureMoonCloud",
+			want:   "unsupported cloud: AzureMoonCloud",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := getGraphCloud(map[string]string{"cloud": tc.cloud})
+			if diff := cmp.Diff(tc.want, errString(err)); diff != "" {
+				t.Errorf("%s\ngetGraphCloud(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+)
+
+// Supported values for the authType field of the azure-creds credentials
+const (
+	authTypeClientSecret      = "ClientSecret"
+	authTypeWorkloadIdentity  = "WorkloadIdentity"
+	authTypeClientCertificate = "ClientCertificate"
+	authTypeManagedIdentity   = "ManagedIdentity"
+)
+
+// requiredCredentialFields lists the azure-creds fields each authType cannot do without
+var requiredCredentialFields = map[string][]string{
+	authTypeClientSecret:      {"tenantId", "clientId", "clientSecret"},
+	authTypeWorkloadIdentity:  {},
+	authTypeClientCertificate: {"tenantId", "clientId", "clientCertificate"},
+	authTypeManagedIdentity:   {},
+}
+
+// validateCreds checks that the credentials carry every field required by their authType
+func validateCreds(azureCreds map[string]string) error {
+	authType := azureCreds["authType"]
+	if authType == "" {
+		authType = authTypeClientSecret
+	}
+
+	required, ok := requiredCredentialFields[authType]
+	if !ok {
+		return errors.Errorf("unsupported authType: %s", authType)
+	}
+	if _, err := getGraphCloud(azureCreds); err != nil {
+		return err
+	}
+
+	for _, field := range required {
+		if azureCreds[field] == "" {
+			return errors.Errorf("failed to get azure-creds credentials: %s is required for authType %s", field, authType)
+		}
+	}
+	return nil
+}
+
+// newTokenCredential builds the Azure credential selected by the authType field of the credentials
+func (g *GraphQuery) newTokenCredential(azureCreds map[string]string) (azcore.TokenCredential, error) {
+	tenantID := azureCreds["tenantId"]
+	clientID := azureCreds["clientId"]
+
+	// Authenticate against the Microsoft Entra ID authority of the selected cloud
+	gc, err := getGraphCloud(azureCreds)
+	if err != nil {
+		return nil, err
+	}
+	clientOptions := g.clientOptions
+	clientOptions.Cloud = gc.authority
+
+	switch authType := azureCreds["authType"]; authType {
+	case "", authTypeClientSecret:
+		cred, err := azidentity.NewClientSecretCredential(tenantID, clientID, azureCreds["clientSecret"], &azidentity.ClientSecretCredentialOptions{
+			ClientOptions: clientOptions,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to obtain credentials")
+		}
+		return cred, nil
+	case authTypeWorkloadIdentity:
+		// Empty fields fall back to the AZURE_TENANT_ID, AZURE_CLIENT_ID and
+		// AZURE_FEDERATED_TOKEN_FILE variables injected by the workload identity webhook
+		cred, err := azidentity.NewWorkloadIdentityCredential(&azidentity.WorkloadIdentityCredentialOptions{
+			ClientOptions: clientOptions,
+			TenantID:      tenantID,
+			ClientID:      clientID,
+			TokenFilePath: azureCreds["federatedTokenFile"],
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to obtain workload identity credentials")
+		}
+		return cred, nil
+	case authTypeClientCertificate:
+		certs, key, err := parseClientCertificate(azureCreds)
+		if err != nil {
+			return nil, err
+		}
+		cred, err := azidentity.NewClientCertificateCredential(tenantID, clientID, certs, key, &azidentity.ClientCertificateCredentialOptions{
+			ClientOptions: clientOptions,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to obtain certificate credentials")
+		}
+		return cred, nil
+	case authTypeManagedIdentity:
+		// Without a clientId the system-assigned identity is used
+		opts := &azidentity.ManagedIdentityCredentialOptions{ClientOptions: clientOptions}
+		if clientID != "" {
+			opts.ID = azidentity.ClientID(clientID)
+		}
+		cred, err := azidentity.NewManagedIdentityCredential(opts)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to obtain managed identity credentials")
+		}
+		return cred, nil
+	default:
+		return nil, errors.Errorf("unsupported authType: %s", authType)
+	}
+}
+
+// parseClientCertificate parses the PEM or base64 encoded PFX client certificate from the credentials
+func parseClientCertificate(azureCreds map[string]string) ([]*x509.Certificate, crypto.PrivateKey, error) {
+	rawCert := azureCreds["clientCertificate"]
+	if rawCert == "" {
+		return nil, nil, errors.New("no clientCertificate provided for ClientCertificate authType")
+	}
+
+	// PEM is used as is, anything else is expected to be a base64 encoded PFX
+	certData := []byte(rawCert)
+	if !strings.Contains(rawCert, "-----BEGIN") {
+		decoded, err := base64.StdEncoding.DecodeString(rawCert)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to decode client certificate")
+		}
+		certData = decoded
+	}
+
+	var password []byte
+	if pw := azureCreds["clientCertificatePassword"]; pw != "" {
+		password = []byte(pw)
+	}
+
+	certs, key, err := azidentity.ParseCertificates(certData, password)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to parse client certificate")
+	}
+	return certs, key, nil
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/google/go-cmp/cmp"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+)
+
+// fakeTokenEndpoint serves the OpenID configuration and token endpoints of a
+// Microsoft Entra ID authority as well as the managed identity endpoint of the
+// instance metadata service, and records the client assertions and managed
+// identity client IDs it receives.
+type fakeTokenEndpoint struct {
+	server     *httptest.Server
+	hosts      []string
+	assertions []string
+	clientIDs  []string
+}
+
+func newFakeTokenEndpoint(t *testing.T) *fakeTokenEndpoint {
+	t.Helper()
+
+	e := &fakeTokenEndpoint{}
+	e.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		tenant := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")[0]
+
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/.well-known/openid-configuration"):
+			authority := "https://login.microsoftonline.com/" + tenant
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"authorization_endpoint": authority + "/oauth2/v2.0/authorize",
+				"token_endpoint":         authority + "/oauth2/v2.0/token",
+				"issuer":                 authority + "/v2.0",
+			})
+		case strings.HasSuffix(r.URL.Path, "/oauth2/v2.0/token"):
+			if err := r.ParseForm(); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			e.assertions = append(e.assertions, r.PostForm.Get("client_assertion"))
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"token_type":   "Bearer",
+				"access_token": "fake-access-token",
+				"expires_in":   3600,
+			})
+		case r.URL.Path == "/metadata/identity/oauth2/token":
+			e.clientIDs = append(e.clientIDs, r.URL.Query().Get("client_id"))
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"token_type":   "Bearer",
+				"access_token": "fake-access-token",
+				"expires_in":   3600,
+				"resource":     r.URL.Query().Get("resource"),
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(e.server.Close)
+
+	return e
+}
+
+// clientOptions returns client options that route every token request to the fake endpoint.
+func (e *fakeTokenEndpoint) clientOptions() azcore.ClientOptions {
+	target, _ := url.Parse(e.server.URL)
+	return azcore.ClientOptions{
+		Transport: &redirectTransport{target: target, client: e.server.Client(), hosts: &e.hosts},
+		Retry:     policy.RetryOptions{MaxRetries: -1},
+	}
+}
+
+// redirectTransport rewrites the scheme and host of every request to the
+// target, recording the hosts the requests were originally sent to.
+type redirectTransport struct {
+	target *url.URL
+	client *http.Client
+	hosts  *[]string
+}
+
+func (t *redirectTransport) Do(req *http.Request) (*http.Response, error) {
+	*t.hosts = append(*t.hosts, req.URL.Host)
+	r := req.Clone(req.Context())
+	r.URL.Scheme = t.target.Scheme
+	r.URL.Host = t.target.Host
+	r.Host = ""
+	return t.client.Do(r)
+}
+
+func TestNewTokenCredential(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "azure-identity-token")
+	if err := os.WriteFile(tokenFile, []byte("projected-sa-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	type want struct {
+		token      string
+		assertions []string
+		clientIDs  []string
+		err        string
+	}
+
+	cases := map[string]struct {
+		reason     string
+		azureCreds map[string]string
+		want       want
+	}{
+		"WorkloadIdentity": {
+			reason: "The projected service account token should be exchanged for an access token",
+			azureCreds: map[string]string{
+				"authType":           "WorkloadIdentity",
+				"tenantId":           "test-tenant-id",
+				"clientId":           "test-client-id",
+				"federatedTokenFile": tokenFile,
+			},
+			want: want{
+				token:      "fake-access-token",
+				assertions: []string{"projected-sa-token"},
+			},
+		},
+		"WorkloadIdentityMissingTokenFile": {
+			reason: "A missing token file should fail the token exchange",
+			azureCreds: map[string]string{
+				"authType":           "WorkloadIdentity",
+				"tenantId":           "test-tenant-id",
+				"clientId":           "test-client-id",
+				"federatedTokenFile": filepath.Join(t.TempDir(), "missing"),
+			},
+			want: want{
+				err: "no such file or directory",
+			},
+		},
+		"ClientCertificateMissing": {
+			reason: "The ClientCertificate authType should require a certificate",
+			azureCreds: map[string]string{
+				"authType": "ClientCertificate",
+				"tenantId": "test-tenant-id",
+				"clientId": "test-client-id",
+			},
+			want: want{
+				err: "no clientCertificate provided for ClientCertificate authType",
+			},
+		},
+		"ClientCertificateNotBase64": {
+			reason: "A certificate that is neither PEM nor base64 should fail to decode",
+			azureCreds: map[string]string{
+				"authType":          "ClientCertificate",
+				"tenantId":          "test-tenant-id",
+				"clientId":          "test-client-id",
+				"clientCertificate": "not a certificate!",
+			},
+			want: want{
+				err: "failed to decode client certificate",
+			},
+		},
+		"ClientCertificateInvalidPFX": {
+			reason: "A base64 encoded certificate that is not a valid PFX should fail to parse",
+			azureCreds: map[string]string{
+				"authType":                  "ClientCertificate",
+				"tenantId":                  "test-tenant-id",
+				"clientId":                  "test-client-id",
+				"clientCertificate":         base64.StdEncoding.EncodeToString([]byte("garbage")),
+				"clientCertificatePassword": "secret",
+			},
+			want: want{
+				err: "failed to parse client certificate",
+			},
+		},
+		"UserAssignedManagedIdentity": {
+			reason: "The managed identity endpoint should be asked for a token of the given client ID",
+			azureCreds: map[string]string{
+				"authType": "ManagedIdentity",
+				"clientId": "test-client-id",
+			},
+			want: want{
+				token:     "fake-access-token",
+				clientIDs: []string{"test-client-id"},
+			},
+		},
+		"UnsupportedCloud": {
+			reason: "An unknown cloud should be rejected",
+			azureCreds: map[string]string{
+				"cloud": "AzureGermanCloud",
+			},
+			want: want{
+				err: "unsupported cloud: AzureGermanCloud",
+			},
+		},
+		"UnsupportedAuthType": {
+			reason: "An unknown authType should be rejected",
+			azureCreds: map[string]string{
+				"authType": "Kerberos",
+			},
+			want: want{
+				err: "unsupported authType: Kerberos",
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			endpoint := newFakeTokenEndpoint(t)
+			g := &GraphQuery{clientOptions: endpoint.clientOptions()}
+
+			var token string
+			cred, err := g.newTokenCredential(tc.azureCreds)
+			if err == nil {
+				var tk azcore.AccessToken
+				tk, err = cred.GetToken(context.Background(), policy.TokenRequestOptions{
+					Scopes: []string{"https://graph.microsoft.com/.default"},
+				})
+				token = tk.Token
+			}
+
+			if gotErr := fmt.Sprint(err); tc.want.err != "" && !strings.Contains(gotErr, tc.want.err) {
+				t.Errorf("%s\nnewTokenCredential(...): want error containing %q, got %q", tc.reason, tc.want.err, gotErr)
+			}
+			if tc.want.err == "" && err != nil {
+				t.Errorf("%s\nnewTokenCredential(...): unexpected error: %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want.token, token); diff != "" {
+				t.Errorf("%s\nGetToken(...): -want token, +got token:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.assertions, endpoint.assertions); diff != "" {
+				t.Errorf("%s\nfake token endpoint: -want assertions, +got assertions:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.clientIDs, endpoint.clientIDs); diff != "" {
+				t.Errorf("%s\nfake token endpoint: -want managed identity client IDs, +got client IDs:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetCreds(t *testing.T) {
+	credentials := func(raw string) map[string]*fnv1.Credentials {
+		return map[string]*fnv1.Credentials{
+			"azure-creds": {
+				Source: &fnv1.Credentials_CredentialData{
+					CredentialData: &fnv1.CredentialData{
+						Data: map[string][]byte{"credentials": []byte(raw)},
+					},
+				},
+			},
+		}
+	}
+
+	type want struct {
+		azureCreds map[string]string
+		err        string
+	}
+
+	cases := map[string]struct {
+		reason      string
+		credentials map[string]*fnv1.Credentials
+		want        want
+	}{
+		"NoCredentials": {
+			reason: "Without an azure-creds secret the function should use its managed identity",
+			want: want{
+				azureCreds: map[string]string{"authType": "ManagedIdentity"},
+			},
+		},
+		"ClientSecret": {
+			reason:      "Client secret credentials should be returned as is",
+			credentials: credentials(`{"tenantId": "t", "clientId": "c", "clientSecret": "s"}`),
+			want: want{
+				azureCreds: map[string]string{"tenantId": "t", "clientId": "c", "clientSecret": "s"},
+			},
+		},
+		"ClientSecretMissingSecret": {
+			reason:      "Client secret credentials without a secret should be rejected",
+			credentials: credentials(`{"tenantId": "t", "clientId": "c"}`),
+			want: want{
+				err: "failed to get azure-creds credentials: clientSecret is required for authType ClientSecret",
+			},
+		},
+		"ClientCertificateMissingCertificate": {
+			reason:      "Certificate credentials without a certificate should be rejected",
+			credentials: credentials(`{"authType": "ClientCertificate", "tenantId": "t", "clientId": "c"}`),
+			want: want{
+				err: "failed to get azure-creds credentials: clientCertificate is required for authType ClientCertificate",
+			},
+		},
+		"ManagedIdentityWithClientID": {
+			reason:      "Managed identity credentials only need an optional client ID",
+			credentials: credentials(`{"authType": "ManagedIdentity", "clientId": "c"}`),
+			want: want{
+				azureCreds: map[string]string{"authType": "ManagedIdentity", "clientId": "c"},
+			},
+		},
+		"UnsupportedAuthType": {
+			reason:      "An unknown authType should be rejected",
+			credentials: credentials(`{"authType": "Kerberos"}`),
+			want: want{
+				err: "unsupported authType: Kerberos",
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			azureCreds, err := getCreds(&fnv1.RunFunctionRequest{Credentials: tc.credentials})
+
+			if diff := cmp.Diff(tc.want.azureCreds, azureCreds); diff != "" {
+				t.Errorf("%s\ngetCreds(...): -want creds, +got creds:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, errString(err)); diff != "" {
+				t.Errorf("%s\ngetCreds(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func TestNewTokenCredentialClientCertificate(t *testing.T) {
+	certPEM := newTestCertificatePEM(t)
+
+	endpoint := newFakeTokenEndpoint(t)
+	g := &GraphQuery{clientOptions: endpoint.clientOptions()}
+
+	cred, err := g.newTokenCredential(map[string]string{
+		"authType":          "ClientCertificate",
+		"tenantId":          "test-tenant-id",
+		"clientId":          "test-client-id",
+		"clientCertificate": certPEM,
+	})
+	if err != nil {
+		t.Fatalf("newTokenCredential(...): unexpected error: %v", err)
+	}
+
+	tk, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{
+		Scopes: []string{"https://graph.microsoft.com/.default"},
+	})
+	if err != nil {
+		t.Fatalf("GetToken(...): unexpected error: %v", err)
+	}
+	if diff := cmp.Diff("fake-access-token", tk.Token); diff != "" {
+		t.Errorf("GetToken(...): -want token, +got token:\n%s", diff)
+	}
+
+	// The certificate credential sends a JWT assertion signed with the certificate key
+	if len(endpoint.assertions) != 1 {
+		t.Fatalf("fake token endpoint: want 1 assertion, got %d", len(endpoint.assertions))
+	}
+	parts := strings.Split(endpoint.assertions[0], ".")
+	if len(parts) != 3 {
+		t.Fatalf("fake token endpoint: want a JWT assertion, got %q", endpoint.assertions[0])
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("cannot decode JWT assertion payload: %v", err)
+	}
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatalf("cannot parse JWT assertion payload: %v", err)
+	}
+	if diff := cmp.Diff("test-client-id", claims["sub"]); diff != "" {
+		t.Errorf("JWT assertion: -want sub, +got sub:\n%s", diff)
+	}
+}
+
+// newTestCertificatePEM returns a self-signed certificate and its private key, PEM encoded.
+func newTestCertificatePEM(t *testing.T) string {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "function-msgraph-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return string(certPEM) + string(keyPEM)
+}
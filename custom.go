@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	abstractions "github.com/microsoft/kiota-abstractions-go"
+	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
+	"github.com/microsoftgraph/msgraph-sdk-go/models/odataerrors"
+	"github.com/upbound/function-msgraph/input/v1beta1"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+)
+
+// defaultCustomPathPrefixes are the paths Custom queries may read if the
+// function is not configured with its own allowlist
+var defaultCustomPathPrefixes = []string{
+	"/users",
+	"/groups",
+	"/servicePrincipals",
+	"/applications",
+	"/directoryRoles",
+	"/roleManagement/directory",
+	"/organization",
+	"/domains",
+}
+
+// customPathRegex matches a path made of non-empty segments of unreserved
+// characters, sub-delimiters, colons and at signs. Percent-encoding, query
+// strings, fragments and URI template braces are not allowed.
+var customPathRegex = regexp.MustCompile(`^(/[A-Za-z0-9\-._~!$&'()*+,;=:@]+)+$`)
+
+// customPath checks that a Custom query path is a relative Microsoft Graph path
+// starting with one of the allowed prefixes, and returns it
+func customPath(path string, prefixes []string) (string, error) {
+	if !customPathRegex.MatchString(path) {
+		return "", errors.Errorf("invalid path %q: must be a relative path such as /groups, without query parameters", path)
+	}
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "." || segment == ".." {
+			return "", errors.Errorf("invalid path %q: must not contain . or .. segments", path)
+		}
+	}
+
+	// Microsoft Graph paths are case-insensitive, prefixes match whole segments
+	lower := strings.ToLower(path)
+	for _, prefix := range prefixes {
+		prefix = strings.ToLower(strings.TrimSuffix(prefix, "/"))
+		if lower == prefix || strings.HasPrefix(lower, prefix+"/") {
+			return path, nil
+		}
+	}
+	return "", errors.Errorf("path %s is not allowed, allowed path prefixes are: %s", path, strings.Join(prefixes, ", "))
+}
+
+// customPathPrefixes returns the paths Custom queries may read
+func (g *GraphQuery) customPathPrefixes() []string {
+	if len(g.allowedPaths) > 0 {
+		return g.allowedPaths
+	}
+	return defaultCustomPathPrefixes
+}
+
+// getCustom reads the path of a Custom query with the OData query options of
+// the input. A collection is returned as a list of objects, following result
+// pages up to maxResults, or only the first page if top is set. Any other
+// response, such as a single object, is returned as is.
+func (g *GraphQuery) getCustom(ctx context.Context, client *msgraphsdk.GraphServiceClient, in *v1beta1.Input) (interface{}, error) {
+	if in.Path == nil || *in.Path == "" {
+		return nil, errors.New("no path provided")
+	}
+	path, err := customPath(*in.Path, g.customPathPrefixes())
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL := client.GetAdapter().GetBaseUrl()
+	requestURL, err := url.Parse(baseURL + path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid path %q", path)
+	}
+	requestURL.RawQuery = customQuery(in)
+
+	body, err := getCustomPage(ctx, client, requestURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get %s", path)
+	}
+
+	page, ok := body.(map[string]interface{})
+	if !ok {
+		return body, nil
+	}
+	values, ok := page["value"].([]interface{})
+	if !ok {
+		delete(page, "@odata.context")
+		return page, nil
+	}
+
+	// Collect the objects of each page, a set top returns only the first page
+	var results []interface{}
+	limit := newResultLimit(in)
+	for {
+		for _, value := range values {
+			if limit.reached(len(results)) {
+				limit.warn(ctx, in.QueryType)
+				return results, nil
+			}
+			results = append(results, value)
+		}
+
+		nextLink, _ := page["@odata.nextLink"].(string)
+		if nextLink == "" || in.Top != nil {
+			return results, nil
+		}
+		if limit.reached(len(results)) {
+			limit.warn(ctx, in.QueryType)
+			return results, nil
+		}
+
+		// Only follow next links to Microsoft Graph, which the token is for
+		if !strings.HasPrefix(nextLink, baseURL+"/") {
+			return nil, errors.Errorf("unexpected next link %s", nextLink)
+		}
+		nextURL, err := url.Parse(nextLink)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid next link %s", nextLink)
+		}
+		body, err := getCustomPage(ctx, client, nextURL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get %s", path)
+		}
+		page, _ = body.(map[string]interface{})
+		values, _ = page["value"].([]interface{})
+	}
+}
+
+// customQuery encodes the OData query options of a Custom query
+func customQuery(in *v1beta1.Input) string {
+	query := url.Values{}
+	if in.Filter != nil && *in.Filter != "" {
+		query.Set("$filter", *in.Filter)
+	}
+	if len(in.Select) > 0 {
+		query.Set("$select", strings.Join(in.Select, ","))
+	}
+	if len(in.Expand) > 0 {
+		query.Set("$expand", strings.Join(in.Expand, ","))
+	}
+	if len(in.OrderBy) > 0 {
+		query.Set("$orderby", strings.Join(in.OrderBy, ","))
+	}
+	if in.Top != nil {
+		query.Set("$top", strconv.Itoa(*in.Top))
+	}
+
+	// Microsoft Graph does not read + as a space in OData query options
+	return strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+// getCustomPage sends a GET request for the URL and decodes its JSON response
+func getCustomPage(ctx context.Context, client *msgraphsdk.GraphServiceClient, requestURL *url.URL) (interface{}, error) {
+	requestInfo := abstractions.NewRequestInformation()
+	requestInfo.Method = abstractions.GET
+	requestInfo.SetUri(*requestURL)
+	requestInfo.Headers.TryAdd("Accept", "application/json")
+
+	errorMapping := abstractions.ErrorMappings{
+		"XXX": odataerrors.CreateODataErrorFromDiscriminatorValue,
+	}
+	raw, err := client.GetAdapter().SendPrimitive(ctx, requestInfo, "[]byte", errorMapping)
+	if err != nil {
+		return nil, err
+	}
+	content, ok := raw.([]byte)
+	if !ok || len(content) == 0 {
+		return nil, nil
+	}
+
+	var body interface{}
+	if err := json.Unmarshal(content, &body); err != nil {
+		return nil, errors.Wrap(err, "failed to decode response")
+	}
+	return body, nil
+}
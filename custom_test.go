@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/upbound/function-msgraph/input/v1beta1"
+)
+
+func TestCustomPath(t *testing.T) {
+	type want struct {
+		path string
+		err  string
+	}
+
+	cases := map[string]struct {
+		reason   string
+		path     string
+		prefixes []string
+		want     want
+	}{
+		"AllowedPrefix": {
+			reason: "A path equal to an allowed prefix should be allowed",
+			path:   "/groups",
+			want:   want{path: "/groups"},
+		},
+		"BelowAllowedPrefix": {
+			reason: "A path below an allowed prefix should be allowed, regardless of case",
+			path:   "/Groups/00000000-0000-0000-0000-000000000001/transitiveMembers/$count",
+			want:   want{path: "/Groups/00000000-0000-0000-0000-000000000001/transitiveMembers/$count"},
+		},
+		"KeySyntax": {
+			reason: "A path using OData key syntax should be allowed",
+			path:   "/applications(appId='00000000-0000-0000-0000-000000000001')",
+			want:   want{path: "/applications(appId='00000000-0000-0000-0000-000000000001')"},
+		},
+		"PartialSegment": {
+			reason: "A prefix should only match whole path segments",
+			path:   "/groupsLifecyclePolicies",
+			want:   want{err: "path /groupsLifecyclePolicies is not allowed, allowed path prefixes are: " + "/users, /groups, /servicePrincipals, /applications, /directoryRoles, /roleManagement/directory, /organization, /domains"},
+		},
+		"ConfiguredPrefixes": {
+			reason:   "Paths should be checked against the configured prefixes rather than the defaults",
+			path:     "/users/someone@example.com",
+			prefixes: []string{"/devices/"},
+			want:     want{err: "path /users/someone@example.com is not allowed, allowed path prefixes are: /devices/"},
+		},
+		"ConfiguredPrefixAllowed": {
+			reason:   "A path below a configured prefix with a trailing slash should be allowed",
+			path:     "/devices",
+			prefixes: []string{"/devices/"},
+			want:     want{path: "/devices"},
+		},
+		"Relative": {
+			reason: "A path not starting with a slash should be rejected",
+			path:   "groups",
+			want:   want{err: `invalid path "groups": must be a relative path such as /groups, without query parameters`},
+		},
+		"AbsoluteURL": {
+			reason: "An absolute URL should be rejected",
+			path:   "https://example.com/groups",
+			want:   want{err: `invalid path "https://example.com/groups": must be a relative path such as /groups, without query parameters`},
+		},
+		"QueryString": {
+			reason: "Query parameters should be set through the input rather than the path",
+			path:   "/groups?$top=1",
+			want:   want{err: `invalid path "/groups?$top=1": must be a relative path such as /groups, without query parameters`},
+		},
+		"EmptySegment": {
+			reason: "A path with an empty segment should be rejected",
+			path:   "//example.com/groups",
+			want:   want{err: `invalid path "//example.com/groups": must be a relative path such as /groups, without query parameters`},
+		},
+		"Encoded": {
+			reason: "Percent-encoding should be rejected, so that it cannot hide a path traversal",
+			path:   "/groups/%2e%2e/me",
+			want:   want{err: `invalid path "/groups/%2e%2e/me": must be a relative path such as /groups, without query parameters`},
+		},
+		"Traversal": {
+			reason: "A path traversing out of an allowed prefix should be rejected",
+			path:   "/groups/../me/messages",
+			want:   want{err: `invalid path "/groups/../me/messages": must not contain . or .. segments`},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			g := &GraphQuery{allowedPaths: tc.prefixes}
+			path, err := customPath(tc.path, g.customPathPrefixes())
+
+			if diff := cmp.Diff(tc.want.path, path); diff != "" {
+				t.Errorf("%s\ncustomPath(...): -want path, +got path:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, errString(err)); diff != "" {
+				t.Errorf("%s\ncustomPath(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetCustom(t *testing.T) {
+	client := newFakeGraphClient(t, map[string]string{
+		"/v1.0/groups?$filter=startsWith(displayName,'platform-')": `{
+			"@odata.context": "{{server}}/v1.0/$metadata#groups",
+			"value": [
+				{"id": "group-1", "displayName": "platform-admins"},
+				{"id": "group-2", "displayName": "platform-operators"}
+			],
+			"@odata.nextLink": "{{server}}/v1.0/groups?$skiptoken=page-2"
+		}`,
+		"/v1.0/groups?$skiptoken=page-2": `{
+			"value": [
+				{"id": "group-3", "displayName": "platform-readers"}
+			]
+		}`,
+		"/v1.0/organization/org-1": `{"@odata.context": "{{server}}/v1.0/$metadata#organization/$entity", "id": "org-1", "verifiedDomains": [{"name": "example.com", "isDefault": true}]}`,
+		"/v1.0/groups/$count":      `3`,
+		"/v1.0/users":              `{"value": [], "@odata.nextLink": "https://example.com/v1.0/users?$skiptoken=page-2"}`,
+	})
+
+	type want struct {
+		results  interface{}
+		warnings []string
+		err      string
+	}
+
+	cases := map[string]struct {
+		reason string
+		in     *v1beta1.Input
+		want   want
+	}{
+		"Collection": {
+			reason: "A collection should be returned as a list of objects across all pages",
+			in: &v1beta1.Input{
+				QueryType: "Custom",
+				Path:      strPtr("/groups"),
+				Filter:    strPtr("startsWith(displayName,'platform-')"),
+			},
+			want: want{
+				results: []interface{}{
+					map[string]interface{}{"id": "group-1", "displayName": "platform-admins"},
+					map[string]interface{}{"id": "group-2", "displayName": "platform-operators"},
+					map[string]interface{}{"id": "group-3", "displayName": "platform-readers"},
+				},
+			},
+		},
+		"MaxResults": {
+			reason: "A collection should be truncated to maxResults with a warning",
+			in: &v1beta1.Input{
+				QueryType:  "Custom",
+				Path:       strPtr("/groups"),
+				Filter:     strPtr("startsWith(displayName,'platform-')"),
+				MaxResults: intPtr(2),
+			},
+			want: want{
+				results: []interface{}{
+					map[string]interface{}{"id": "group-1", "displayName": "platform-admins"},
+					map[string]interface{}{"id": "group-2", "displayName": "platform-operators"},
+				},
+				warnings: []string{"Custom results were truncated to maxResults (2)"},
+			},
+		},
+		"Top": {
+			reason: "Only the first page of a collection should be returned if top is set",
+			in: &v1beta1.Input{
+				QueryType: "Custom",
+				Path:      strPtr("/groups"),
+				Filter:    strPtr("startsWith(displayName,'platform-')"),
+				Top:       intPtr(2),
+			},
+			want: want{
+				results: []interface{}{
+					map[string]interface{}{"id": "group-1", "displayName": "platform-admins"},
+					map[string]interface{}{"id": "group-2", "displayName": "platform-operators"},
+				},
+			},
+		},
+		"Object": {
+			reason: "A single object should be returned as is, without its OData context",
+			in: &v1beta1.Input{
+				QueryType: "Custom",
+				Path:      strPtr("/organization/org-1"),
+			},
+			want: want{
+				results: map[string]interface{}{
+					"id":              "org-1",
+					"verifiedDomains": []interface{}{map[string]interface{}{"name": "example.com", "isDefault": true}},
+				},
+			},
+		},
+		"Count": {
+			reason: "A value that is not an object should be returned as is",
+			in: &v1beta1.Input{
+				QueryType: "Custom",
+				Path:      strPtr("/groups/$count"),
+			},
+			want: want{results: float64(3)},
+		},
+		"ForeignNextLink": {
+			reason: "A next link that does not point to Microsoft Graph should not be followed",
+			in: &v1beta1.Input{
+				QueryType: "Custom",
+				Path:      strPtr("/users"),
+			},
+			want: want{err: "unexpected next link https://example.com/v1.0/users?$skiptoken=page-2"},
+		},
+		"NotAllowed": {
+			reason: "A path outside the allowed prefixes should not be read",
+			in: &v1beta1.Input{
+				QueryType: "Custom",
+				Path:      strPtr("/me/messages"),
+			},
+			want: want{err: "path /me/messages is not allowed, allowed path prefixes are: " + "/users, /groups, /servicePrincipals, /applications, /directoryRoles, /roleManagement/directory, /organization, /domains"},
+		},
+		"NoPath": {
+			reason: "A Custom query without a path should fail",
+			in: &v1beta1.Input{
+				QueryType: "Custom",
+			},
+			want: want{err: "no path provided"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx, warnings := withQueryWarnings(context.Background())
+			g := &GraphQuery{}
+			results, err := g.getCustom(ctx, client, tc.in)
+
+			if diff := cmp.Diff(tc.want.err, errString(err)); diff != "" {
+				t.Fatalf("%s\ngetCustom(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, results); diff != "" {
+				t.Errorf("%s\ngetCustom(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.warnings, warnings.list(), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("%s\ngetCustom(...): -want warnings, +got warnings:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+)
+
+// maxFilterValueLength is longer than any name Microsoft Graph stores, such as a 256 character displayName
+const maxFilterValueLength = 1024
+
+// eqFilter returns an OData $filter expression matching objects whose property
+// equals value. Names often come from composite resource fields, so the value
+// is validated and its single quotes are escaped, ensuring it can only ever be
+// compared as a string literal and never widen the filter.
+func eqFilter(property, value string) (string, error) {
+	if err := validateFilterValue(value); err != nil {
+		return "", errors.Wrapf(err, "invalid %s", property)
+	}
+	return fmt.Sprintf("%s eq '%s'", property, escapeFilterValue(value)), nil
+}
+
+// guidFilter returns an OData $filter expression matching objects whose GUID
+// property equals value. GUID literals are not quoted, so the value must be a GUID.
+func guidFilter(property, value string) (string, error) {
+	if !isGUID(value) {
+		return "", errors.Errorf("invalid %s: value must be a GUID", property)
+	}
+	return fmt.Sprintf("%s eq %s", property, value), nil
+}
+
+// escapeFilterValue escapes a value for use in an OData string literal by doubling its single quotes
+func escapeFilterValue(value string) string {
+	return strings.ReplaceAll(value, "'", "''")
+}
+
+// validateFilterValue rejects values that cannot be a valid name
+func validateFilterValue(value string) error {
+	switch {
+	case strings.TrimSpace(value) == "":
+		return errors.New("value must not be empty")
+	case len(value) > maxFilterValueLength:
+		return errors.Errorf("value must not be longer than %d bytes", maxFilterValueLength)
+	case !utf8.ValidString(value):
+		return errors.New("value must be valid UTF-8")
+	case strings.IndexFunc(value, unicode.IsControl) >= 0:
+		return errors.New("value must not contain control characters")
+	}
+	return nil
+}
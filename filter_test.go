@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/upbound/function-msgraph/input/v1beta1"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+func TestEqFilter(t *testing.T) {
+	type want struct {
+		filter string
+		err    string
+	}
+
+	cases := map[string]struct {
+		reason string
+		value  string
+		want   want
+	}{
+		"PlainName": {
+			reason: "A plain name should be quoted as is",
+			value:  "Developers",
+			want:   want{filter: "displayName eq 'Developers'"},
+		},
+		"Apostrophe": {
+			reason: "An apostrophe in a name should be escaped rather than end the string literal",
+			value:  "O'Brien",
+			want:   want{filter: "displayName eq 'O''Brien'"},
+		},
+		"OnlyQuotes": {
+			reason: "A name made of quotes should be escaped into a single string literal",
+			value:  "'''",
+			want:   want{filter: "displayName eq ''''''''"},
+		},
+		"OrInjection": {
+			reason: "A name trying to widen the filter with or should stay a single string literal",
+			value:  "x' or displayName ne 'x",
+			want:   want{filter: "displayName eq 'x'' or displayName ne ''x'"},
+		},
+		"FunctionInjection": {
+			reason: "A name trying to add a filter function should stay a single string literal",
+			value:  "a' or startswith(displayName,'",
+			want:   want{filter: "displayName eq 'a'' or startswith(displayName,'''"},
+		},
+		"QueryParameterInjection": {
+			reason: "Query string delimiters are left to URL encoding and should stay in the string literal",
+			value:  "x'&$top=999&$filter=id ne '",
+			want:   want{filter: "displayName eq 'x''&$top=999&$filter=id ne '''"},
+		},
+		"Unicode": {
+			reason: "Names with non ASCII characters should be allowed",
+			value:  "Zoë's Team – München",
+			want:   want{filter: "displayName eq 'Zoë''s Team – München'"},
+		},
+		"Empty": {
+			reason: "An empty name should be rejected rather than match nothing",
+			value:  "",
+			want:   want{err: "invalid displayName: value must not be empty"},
+		},
+		"Whitespace": {
+			reason: "A whitespace only name should be rejected",
+			value:  "   ",
+			want:   want{err: "invalid displayName: value must not be empty"},
+		},
+		"Newline": {
+			reason: "A name containing a newline should be rejected",
+			value:  "Developers\n' or 1 eq 1",
+			want:   want{err: "invalid displayName: value must not contain control characters"},
+		},
+		"NullByte": {
+			reason: "A name containing a NUL byte should be rejected",
+			value:  "Developers\x00",
+			want:   want{err: "invalid displayName: value must not contain control characters"},
+		},
+		"InvalidUTF8": {
+			reason: "A name that is not valid UTF-8 should be rejected",
+			value:  "Developers\xff",
+			want:   want{err: "invalid displayName: value must be valid UTF-8"},
+		},
+		"TooLong": {
+			reason: "A name longer than any stored name should be rejected",
+			value:  strings.Repeat("a", maxFilterValueLength+1),
+			want:   want{err: "invalid displayName: value must not be longer than 1024 bytes"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			filter, err := eqFilter("displayName", tc.value)
+
+			if diff := cmp.Diff(tc.want.filter, filter); diff != "" {
+				t.Errorf("%s\neqFilter(...): -want filter, +got filter:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, errString(err)); diff != "" {
+				t.Errorf("%s\neqFilter(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetGroupObjectIDsEscapesFilter(t *testing.T) {
+	// The fake server only answers the escaped filter, so an unescaped name fails the query
+	client := newFakeGraphClient(t, map[string]string{
+		"/v1.0/groups?$filter=displayName eq 'O''Brien''s Team'": `{"value": [{"id": "group-1", "displayName": "O'Brien's Team"}]}`,
+	})
+
+	g := &GraphQuery{}
+	results, err := g.getGroupObjectIDs(context.Background(), client, &v1beta1.Input{
+		QueryType: "GroupObjectIDs",
+		Groups:    []*string{strPtr("O'Brien's Team")},
+	})
+	if err != nil {
+		t.Fatalf("getGroupObjectIDs(...): unexpected error: %v", err)
+	}
+
+	got := results.([]interface{})
+	if len(got) != 1 || got[0].(map[string]interface{})["id"] != "group-1" {
+		t.Errorf("getGroupObjectIDs(...): want group-1 for a name containing apostrophes, got %v", got)
+	}
+
+	_, err = g.getGroupObjectIDs(context.Background(), client, &v1beta1.Input{
+		QueryType: "GroupObjectIDs",
+		Groups:    []*string{strPtr("Developers\r\n")},
+	})
+	if diff := cmp.Diff("failed to find group Developers\r\n: invalid displayName: value must not contain control characters", errString(err)); diff != "" {
+		t.Errorf("getGroupObjectIDs(...): -want err, +got err:\n%s", diff)
+	}
+}
+
+func TestRunFunctionEscapesRefFilters(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		input  string
+		xr     string
+		want   []string
+	}{
+		"GroupsRef": {
+			reason: "Group names resolved from the XR spec should each be sent as a single escaped string literal",
+			input: `{
+				"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+				"kind": "Input",
+				"queryType": "GroupObjectIDs",
+				"groupsRef": "spec.groups",
+				"target": "status.groups"
+			}`,
+			xr: `{
+				"apiVersion": "example.org/v1",
+				"kind": "XR",
+				"metadata": {"name": "cool-xr"},
+				"spec": {"groups": ["O'Brien's Team", "x') or (displayName eq 'admins"]}
+			}`,
+			want: []string{
+				"displayName eq 'O''Brien''s Team'",
+				"displayName eq 'x'') or (displayName eq ''admins'",
+			},
+		},
+		"UsersRef": {
+			reason: "User names resolved from the XR status should each be sent as a single escaped string literal",
+			input: `{
+				"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+				"kind": "Input",
+				"queryType": "UserValidation",
+				"usersRef": "status.users",
+				"target": "status.validatedUsers"
+			}`,
+			xr: `{
+				"apiVersion": "example.org/v1",
+				"kind": "XR",
+				"metadata": {"name": "cool-xr"},
+				"status": {"users": ["o'neil@example.com') or (accountEnabled eq true"]}
+			}`,
+			want: []string{
+				"userPrincipalName eq 'o''neil@example.com'') or (accountEnabled eq true'",
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var (
+				mu      sync.Mutex
+				filters []string
+			)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				filters = append(filters, r.URL.Query().Get("$filter"))
+				mu.Unlock()
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"value": []}`))
+			}))
+			defer srv.Close()
+
+			req := &fnv1.RunFunctionRequest{
+				Input: resource.MustStructJSON(tc.input),
+				Observed: &fnv1.State{
+					Composite: &fnv1.Resource{Resource: resource.MustStructJSON(tc.xr)},
+				},
+				Credentials: map[string]*fnv1.Credentials{
+					"azure-creds": {
+						Source: &fnv1.Credentials_CredentialData{CredentialData: &fnv1.CredentialData{
+							Data: map[string][]byte{
+								"credentials": []byte(`{"clientId": "client", "clientSecret": "secret", "tenantId": "tenant"}`),
+							},
+						}},
+					},
+				},
+			}
+			azureCreds, err := getCreds(req)
+			if err != nil {
+				t.Fatalf("getCreds(...): unexpected error: %v", err)
+			}
+
+			g := &GraphQuery{}
+			g.clients.add(graphClientCacheKey(azureCreds), newRetryingGraphClient(t, srv))
+			f := &Function{graphQuery: g, log: logging.NewNopLogger()}
+
+			rsp, err := f.RunFunction(context.Background(), req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): unexpected error: %v", tc.reason, err)
+			}
+			for _, r := range rsp.GetResults() {
+				if r.GetSeverity() == fnv1.Severity_SEVERITY_FATAL {
+					t.Fatalf("%s\nf.RunFunction(...): unexpected fatal result: %s", tc.reason, r.GetMessage())
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if diff := cmp.Diff(tc.want, filters); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want filters, +got filters:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -8,11 +8,13 @@ import (
 	"regexp"
 	"strings"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	azauth "github.com/microsoft/kiota-authentication-azure-go"
 	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
+	"github.com/microsoftgraph/msgraph-sdk-go/applications"
 	"github.com/microsoftgraph/msgraph-sdk-go/groups"
 	"github.com/microsoftgraph/msgraph-sdk-go/models"
+	"github.com/microsoftgraph/msgraph-sdk-go/rolemanagement"
 	"github.com/microsoftgraph/msgraph-sdk-go/serviceprincipals"
 	"github.com/microsoftgraph/msgraph-sdk-go/users"
 	"github.com/upbound/function-msgraph/input/v1beta1"
@@ -200,8 +202,20 @@ func (f *Function) executeQuery(ctx context.Context, azureCreds map[string]strin
 		gq.log = f.log
 	}
 
+	ctx, warnings := withQueryWarnings(ctx)
 	results, err := f.graphQuery.graphQuery(ctx, azureCreds, in)
 	if err != nil {
+		// Throttling is transient, so report it without failing the pipeline
+		var throttled *throttledError
+		if errors.As(err, &throttled) {
+			response.ConditionFalse(rsp, "FunctionSuccess", "Throttled").
+				WithMessage(err.Error()).
+				TargetCompositeAndClaim()
+			response.Warning(rsp, err)
+			f.log.Info("THROTTLED: ", "throttled", fmt.Sprint(err))
+			return nil, err
+		}
+
 		response.Fatal(rsp, err)
 		f.log.Info("FAILURE: ", "failure", fmt.Sprint(err))
 		return nil, err
@@ -212,6 +226,12 @@ func (f *Function) executeQuery(ctx context.Context, azureCreds map[string]strin
 	f.log.Info("Results:", "results", fmt.Sprint(results))
 	response.Normalf(rsp, "QueryType: %q", in.QueryType)
 
+	// Report non-fatal problems, such as truncated results
+	for _, warning := range warnings.list() {
+		response.Warning(rsp, errors.New(warning))
+		f.log.Info("WARNING: ", "warning", warning)
+	}
+
 	return results, nil
 }
 
@@ -238,6 +258,7 @@ func (f *Function) processResults(req *fnv1.RunFunctionRequest, in *v1beta1.Inpu
 	return nil
 }
 
+// getCreds reads the azure-creds credentials, defaulting to managed identity when the secret is absent
 func getCreds(req *fnv1.RunFunctionRequest) (map[string]string, error) {
 	var azureCreds map[string]string
 	rawCreds := req.GetCredentials()
@@ -251,7 +272,12 @@ func getCreds(req *fnv1.RunFunctionRequest) (map[string]string, error) {
 			}
 		}
 	} else {
-		return nil, errors.New("failed to get azure-creds credentials")
+		// Without an azure-creds secret the function authenticates as the managed identity of its pod
+		return map[string]string{"authType": authTypeManagedIdentity}, nil
+	}
+
+	if err := validateCreds(azureCreds); err != nil {
+		return nil, err
 	}
 
 	return azureCreds, nil
@@ -261,31 +287,62 @@ func getCreds(req *fnv1.RunFunctionRequest) (map[string]string, error) {
 // that interacts with Microsoft Graph API.
 type GraphQuery struct {
 	log logging.Logger
+
+	// clientOptions configures the HTTP pipeline used to acquire Azure tokens
+	clientOptions azcore.ClientOptions
+
+	// clients caches Microsoft Graph clients across RunFunction calls
+	clients graphClientCache
+
+	// results caches query results for the cacheTTL set in the input
+	results queryResultCache
+
+	// allowedPaths are the path prefixes Custom queries may read
+	allowedPaths []string
+}
+
+// getGraphClient returns the cached Microsoft Graph client for the credentials, creating it if needed
+func (g *GraphQuery) getGraphClient(azureCreds map[string]string) (*msgraphsdk.GraphServiceClient, error) {
+	key := graphClientCacheKey(azureCreds)
+	if client, ok := g.clients.get(key); ok {
+		return client, nil
+	}
+
+	client, err := g.createGraphClient(azureCreds)
+	if err != nil {
+		return nil, err
+	}
+	g.clients.add(key, client)
+
+	return client, nil
 }
 
 // createGraphClient initializes a Microsoft Graph client using the provided credentials
 func (g *GraphQuery) createGraphClient(azureCreds map[string]string) (*msgraphsdk.GraphServiceClient, error) {
-	tenantID := azureCreds["tenantId"]
-	clientID := azureCreds["clientId"]
-	clientSecret := azureCreds["clientSecret"]
-
 	// Create Azure credential for Microsoft Graph
-	cred, err := azidentity.NewClientSecretCredential(tenantID, clientID, clientSecret, nil)
+	cred, err := g.newTokenCredential(azureCreds)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to obtain credentials")
+		return nil, err
+	}
+
+	// Resolve the Microsoft Graph endpoint of the selected cloud
+	gc, err := getGraphCloud(azureCreds)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create authentication provider
-	authProvider, err := azauth.NewAzureIdentityAuthenticationProviderWithScopes(cred, []string{"https://graph.microsoft.com/.default"})
+	authProvider, err := azauth.NewAzureIdentityAuthenticationProviderWithScopes(cred, []string{gc.scope()})
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create auth provider")
 	}
 
-	// Create adapter
-	adapter, err := msgraphsdk.NewGraphRequestAdapter(authProvider)
+	// Create adapter with an HTTP client that retries throttled requests
+	adapter, err := msgraphsdk.NewGraphRequestAdapterWithParseNodeFactoryAndSerializationWriterFactoryAndHttpClient(authProvider, nil, nil, newGraphHTTPClient())
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create graph adapter")
 	}
+	adapter.SetBaseUrl(gc.baseURL())
 
 	// Initialize Microsoft Graph client
 	return msgraphsdk.NewGraphServiceClient(adapter), nil
@@ -293,8 +350,29 @@ func (g *GraphQuery) createGraphClient(azureCreds map[string]string) (*msgraphsd
 
 // graphQuery is a concrete implementation that interacts with Microsoft Graph API.
 func (g *GraphQuery) graphQuery(ctx context.Context, azureCreds map[string]string, in *v1beta1.Input) (interface{}, error) {
-	// Create the Microsoft Graph client
-	client, err := g.createGraphClient(azureCreds)
+	// Query Microsoft Graph directly unless results should be cached
+	if in.CacheTTL == nil || in.CacheTTL.Duration <= 0 {
+		return g.runQuery(ctx, azureCreds, in)
+	}
+
+	key, err := queryResultCacheKey(azureCreds, in)
+	if err != nil {
+		return nil, err
+	}
+
+	results, cached, err := g.results.do(ctx, key, in.CacheTTL.Duration, func(ctx context.Context) (interface{}, error) {
+		return g.runQuery(ctx, azureCreds, in)
+	})
+	if cached && g.log != nil {
+		g.log.Debug("Using cached query results", "queryType", in.QueryType, "cacheTTL", in.CacheTTL.Duration.String())
+	}
+	return results, err
+}
+
+// runQuery runs the query selected by the input against Microsoft Graph API
+func (g *GraphQuery) runQuery(ctx context.Context, azureCreds map[string]string, in *v1beta1.Input) (interface{}, error) {
+	// Reuse or create the Microsoft Graph client
+	client, err := g.getGraphClient(azureCreds)
 	if err != nil {
 		return nil, err
 	}
@@ -307,119 +385,380 @@ func (g *GraphQuery) graphQuery(ctx context.Context, azureCreds map[string]strin
 		return g.getGroupMembers(ctx, client, in)
 	case "GroupObjectIDs":
 		return g.getGroupObjectIDs(ctx, client, in)
+	case "GroupOwners":
+		return g.getGroupOwners(ctx, client, in)
 	case "ServicePrincipalDetails":
 		return g.getServicePrincipalDetails(ctx, client, in)
+	case "ApplicationDetails":
+		return g.getApplicationDetails(ctx, client, in)
+	case "UserMemberOf":
+		return g.getUserMemberOf(ctx, client, in)
+	case "CheckMembership":
+		return g.checkMembership(ctx, client, in)
+	case "DirectoryRoleAssignments":
+		return g.getDirectoryRoleAssignments(ctx, client, in)
+	case "AppRoleAssignments":
+		return g.getAppRoleAssignments(ctx, client, in)
+	case "OAuth2PermissionGrants":
+		return g.getOAuth2PermissionGrants(ctx, client, in)
+	case "Custom":
+		return g.getCustom(ctx, client, in)
 	default:
 		return nil, errors.Errorf("unsupported query type: %s", in.QueryType)
 	}
 }
 
-// validateUsers validates if the provided user principal names (emails) exist
+// validateUsers validates if the provided user principal names (emails) or IDs exist
 func (g *GraphQuery) validateUsers(ctx context.Context, client *msgraphsdk.GraphServiceClient, in *v1beta1.Input) (interface{}, error) {
 	if len(in.Users) == 0 {
 		return nil, errors.New("no users provided for validation")
 	}
 
 	var results []interface{}
+	limit := newResultLimit(in)
+	fields := selectedFields(in)
 
-	for _, userPrincipalName := range in.Users {
+	for i, userPrincipalName := range in.Users {
 		if userPrincipalName == nil {
 			continue
 		}
 
-		// Create request configuration
-		requestConfig := &users.UsersRequestBuilderGetRequestConfiguration{
-			QueryParameters: &users.UsersRequestBuilderGetQueryParameters{},
+		// Look up the user with the selected fields, following the result pages up to the remaining results limit
+		found, truncated, err := g.lookupUsers(ctx, client, lookupProperty(in, *userPrincipalName), *userPrincipalName,
+			fields, limit.remaining(len(results)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to validate user %s", *userPrincipalName)
+		}
+
+		// Process results
+		for _, user := range found {
+			results = append(results, selectedValues(user, fields))
+		}
+
+		if truncated || (limit.reached(len(results)) && i < len(in.Users)-1) {
+			limit.warn(ctx, in.QueryType)
+			break
 		}
+	}
+
+	return results, nil
+}
+
+// lookupUsers looks up the users whose property equals value, up to limit
+func (g *GraphQuery) lookupUsers(ctx context.Context, client *msgraphsdk.GraphServiceClient, property, value string, selectFields []string, limit int) ([]models.Userable, bool, error) {
+	return lookupObjects(ctx, client, property, value, limit,
+		func(id string) (models.Userable, error) {
+			return client.Users().ByUserId(id).Get(ctx, &users.UserItemRequestBuilderGetRequestConfiguration{
+				QueryParameters: &users.UserItemRequestBuilderGetQueryParameters{Select: selectFields},
+			})
+		},
+		func(filter string) (interface{}, error) {
+			return client.Users().Get(ctx, &users.UsersRequestBuilderGetRequestConfiguration{
+				QueryParameters: &users.UsersRequestBuilderGetQueryParameters{Filter: &filter, Select: selectFields},
+			})
+		},
+		models.CreateUserCollectionResponseFromDiscriminatorValue)
+}
 
-		// Build filter expression
-		filterValue := fmt.Sprintf("userPrincipalName eq '%s'", *userPrincipalName)
-		requestConfig.QueryParameters.Filter = &filterValue
+// getUserMemberOf retrieves the groups and directory roles the specified users
+// belong to, keyed by user principal name
+func (g *GraphQuery) getUserMemberOf(ctx context.Context, client *msgraphsdk.GraphServiceClient, in *v1beta1.Input) (interface{}, error) {
+	if len(in.Users) == 0 {
+		return nil, errors.New("no users provided")
+	}
+
+	results := make(map[string]interface{})
+	limit := newResultLimit(in)
+	transitive := in.Transitive != nil && *in.Transitive
+
+	for _, userName := range in.Users {
+		if userName == nil {
+			continue
+		}
 
-		// Use standard fields for user validation
-		requestConfig.QueryParameters.Select = []string{"id", "displayName", "userPrincipalName", "mail"}
+		// Find the user, users that do not exist are left out of the results
+		found, _, err := g.lookupUsers(ctx, client, lookupProperty(in, *userName), *userName,
+			[]string{"id", "displayName", "userPrincipalName"}, 1)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to find user %s", *userName)
+		}
+		if len(found) == 0 || found[0].GetId() == nil || found[0].GetUserPrincipalName() == nil {
+			continue
+		}
+		user := found[0]
 
-		// Execute the query
-		result, err := client.Users().Get(ctx, requestConfig)
+		// Fetch the groups and directory roles, up to the results limit per user
+		firstPage, err := g.getMemberOfPage(ctx, client, *user.GetId(), transitive)
 		if err != nil {
-			return nil, errors.Wrapf(err, "failed to validate user %s", *userPrincipalName)
+			return nil, errors.Wrapf(err, "failed to get memberships for user %s", *userName)
+		}
+		memberships, truncated, err := collectPages[models.DirectoryObjectable](ctx, client, firstPage,
+			models.CreateDirectoryObjectCollectionResponseFromDiscriminatorValue, int(limit))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get memberships for user %s", *userName)
+		}
+		if truncated {
+			addQueryWarning(ctx, "UserMemberOf results for user %s were truncated to maxResults (%d)", *userName, int(limit))
 		}
 
-		// Process results
-		if result.GetValue() != nil {
-			for _, user := range result.GetValue() {
-				userMap := map[string]interface{}{
-					"id":                user.GetId(),
-					"displayName":       user.GetDisplayName(),
-					"userPrincipalName": user.GetUserPrincipalName(),
-					"mail":              user.GetMail(),
-				}
-				results = append(results, userMap)
+		// Sort the memberships into groups and directory roles, leaving out other objects such as administrative units
+		groupList := make([]interface{}, 0, len(memberships))
+		roleList := make([]interface{}, 0)
+		for _, membership := range memberships {
+			switch m := membership.(type) {
+			case models.Groupable:
+				groupList = append(groupList, map[string]interface{}{
+					"id":          optionalString(m.GetId()),
+					"displayName": optionalString(m.GetDisplayName()),
+					"description": optionalString(m.GetDescription()),
+				})
+			case models.DirectoryRoleable:
+				roleList = append(roleList, map[string]interface{}{
+					"id":             optionalString(m.GetId()),
+					"displayName":    optionalString(m.GetDisplayName()),
+					"roleTemplateId": optionalString(m.GetRoleTemplateId()),
+				})
 			}
 		}
+
+		results[*user.GetUserPrincipalName()] = map[string]interface{}{
+			"id":                optionalString(user.GetId()),
+			"displayName":       optionalString(user.GetDisplayName()),
+			"userPrincipalName": *user.GetUserPrincipalName(),
+			"groups":            groupList,
+			"directoryRoles":    roleList,
+		}
 	}
 
 	return results, nil
 }
 
-// findGroupByName finds a group by its display name and returns its ID
-func (g *GraphQuery) findGroupByName(ctx context.Context, client *msgraphsdk.GraphServiceClient, groupName string) (*string, error) {
-	// Create filter by displayName
-	filterValue := fmt.Sprintf("displayName eq '%s'", groupName)
-	groupRequestConfig := &groups.GroupsRequestBuilderGetRequestConfiguration{
-		QueryParameters: &groups.GroupsRequestBuilderGetQueryParameters{
-			Filter: &filterValue,
+// getMemberOfPage gets the first page of the groups and directory roles a user is a direct or transitive member of
+func (g *GraphQuery) getMemberOfPage(ctx context.Context, client *msgraphsdk.GraphServiceClient, userID string, transitive bool) (models.DirectoryObjectCollectionResponseable, error) {
+	top := int32(memberPageSize)
+	if transitive {
+		return client.Users().ByUserId(userID).TransitiveMemberOf().Get(ctx, &users.ItemTransitiveMemberOfRequestBuilderGetRequestConfiguration{
+			QueryParameters: &users.ItemTransitiveMemberOfRequestBuilderGetQueryParameters{
+				Top: &top,
+			},
+		})
+	}
+	return client.Users().ByUserId(userID).MemberOf().Get(ctx, &users.ItemMemberOfRequestBuilderGetRequestConfiguration{
+		QueryParameters: &users.ItemMemberOfRequestBuilderGetQueryParameters{
+			Top: &top,
 		},
-	}
+	})
+}
 
+// findGroup finds a single group by its display name or ID, as the input says
+func (g *GraphQuery) findGroup(ctx context.Context, client *msgraphsdk.GraphServiceClient, in *v1beta1.Input, groupName string) (models.Groupable, error) {
 	// Query for the group
-	groupResult, err := client.Groups().Get(ctx, groupRequestConfig)
+	found, _, err := g.lookupGroups(ctx, client, lookupProperty(in, groupName), groupName, []string{"id", "displayName"}, 1)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to find group")
 	}
 
 	// Verify we found a group
-	if groupResult.GetValue() == nil || len(groupResult.GetValue()) == 0 {
+	if len(found) == 0 {
 		return nil, errors.Errorf("group not found: %s", groupName)
 	}
 
-	// Return the group ID
-	return groupResult.GetValue()[0].GetId(), nil
+	return found[0], nil
 }
 
-// fetchGroupMembers fetches all members of a group by group ID
-func (g *GraphQuery) fetchGroupMembers(ctx context.Context, client *msgraphsdk.GraphServiceClient, groupID string, groupName string) ([]models.DirectoryObjectable, error) {
-	// Create a request configuration that expands members
-	// This is the workaround for the known issue where service principals
-	// are not listed as group members in v1.0
-	// See: https://developer.microsoft.com/en-us/graph/known-issues/?search=25984
-	requestConfig := &groups.GroupItemRequestBuilderGetRequestConfiguration{
-		QueryParameters: &groups.GroupItemRequestBuilderGetQueryParameters{
-			Expand: []string{"members"},
+// lookupGroups looks up the groups whose property equals value, up to limit
+func (g *GraphQuery) lookupGroups(ctx context.Context, client *msgraphsdk.GraphServiceClient, property, value string, selectFields []string, limit int) ([]models.Groupable, bool, error) {
+	return lookupObjects(ctx, client, property, value, limit,
+		func(id string) (models.Groupable, error) {
+			return client.Groups().ByGroupId(id).Get(ctx, &groups.GroupItemRequestBuilderGetRequestConfiguration{
+				QueryParameters: &groups.GroupItemRequestBuilderGetQueryParameters{Select: selectFields},
+			})
 		},
+		func(filter string) (interface{}, error) {
+			return client.Groups().Get(ctx, &groups.GroupsRequestBuilderGetRequestConfiguration{
+				QueryParameters: &groups.GroupsRequestBuilderGetQueryParameters{Filter: &filter, Select: selectFields},
+			})
+		},
+		models.CreateGroupCollectionResponseFromDiscriminatorValue)
+}
+
+// fetchGroupMembers fetches the members of a group by group ID, up to maxMembers.
+// With transitive it also fetches the members of nested groups. The returned
+// bool reports whether members were left out.
+func (g *GraphQuery) fetchGroupMembers(ctx context.Context, client *msgraphsdk.GraphServiceClient, groupID string, groupName string, maxMembers int, transitive bool) ([]models.DirectoryObjectable, bool, error) {
+	// Page through the members rather than expanding them on the group,
+	// because expanded navigation properties are capped at 20 items
+	firstPage, err := g.getMembersPage(ctx, client, groupID, transitive)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "failed to get members for group %s", groupName)
 	}
 
-	// Get the group with expanded members using the workaround
-	// mentioned in the Microsoft documentation
-	group, err := client.Groups().ByGroupId(groupID).Get(ctx, requestConfig)
+	members, truncated, err := collectPages[models.DirectoryObjectable](ctx, client, firstPage,
+		models.CreateDirectoryObjectCollectionResponseFromDiscriminatorValue, maxMembers)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to get members for group %s", groupName)
+		return nil, false, errors.Wrapf(err, "failed to get members for group %s", groupName)
 	}
 
-	// Extract the members from the expanded result
-	var members []models.DirectoryObjectable
-	if group.GetMembers() != nil {
-		members = group.GetMembers()
+	// This is the workaround for the known issue where service principals
+	// are not listed as group members in v1.0. Listing the members cast to
+	// servicePrincipal returns them, so add any the listing above missed.
+	// See: https://developer.microsoft.com/en-us/graph/known-issues/?search=25984
+	if !truncated {
+		servicePrincipals, err := g.fetchGroupServicePrincipalMembers(ctx, client, groupID, groupName, maxMembers, transitive)
+		if err != nil {
+			return nil, false, err
+		}
+		members, truncated = mergeMembers(members, servicePrincipals, maxMembers)
 	}
 
 	// Log basic information about the membership
 	if g.log != nil {
-		g.log.Debug("Retrieved group members", "groupName", groupName, "groupID", groupID, "memberCount", len(members))
+		g.log.Debug("Retrieved group members", "groupName", groupName, "groupID", groupID, "transitive", transitive, "memberCount", len(members))
+	}
+
+	return members, truncated, nil
+}
+
+// getMembersPage gets the first page of the direct or transitive members of a group
+func (g *GraphQuery) getMembersPage(ctx context.Context, client *msgraphsdk.GraphServiceClient, groupID string, transitive bool) (models.DirectoryObjectCollectionResponseable, error) {
+	top := int32(memberPageSize)
+	if transitive {
+		return client.Groups().ByGroupId(groupID).TransitiveMembers().Get(ctx, &groups.ItemTransitiveMembersRequestBuilderGetRequestConfiguration{
+			QueryParameters: &groups.ItemTransitiveMembersRequestBuilderGetQueryParameters{
+				Top: &top,
+			},
+		})
+	}
+	return client.Groups().ByGroupId(groupID).Members().Get(ctx, &groups.ItemMembersRequestBuilderGetRequestConfiguration{
+		QueryParameters: &groups.ItemMembersRequestBuilderGetQueryParameters{
+			Top: &top,
+		},
+	})
+}
+
+// fetchGroupServicePrincipalMembers fetches the direct or transitive service principal members of a group by group ID
+func (g *GraphQuery) fetchGroupServicePrincipalMembers(ctx context.Context, client *msgraphsdk.GraphServiceClient, groupID string, groupName string, maxMembers int, transitive bool) ([]models.DirectoryObjectable, error) {
+	firstPage, err := g.getServicePrincipalMembersPage(ctx, client, groupID, transitive)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get service principal members for group %s", groupName)
+	}
+
+	servicePrincipals, _, err := collectPages[models.ServicePrincipalable](ctx, client, firstPage,
+		models.CreateServicePrincipalCollectionResponseFromDiscriminatorValue, maxMembers)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get service principal members for group %s", groupName)
 	}
 
+	members := make([]models.DirectoryObjectable, 0, len(servicePrincipals))
+	for _, sp := range servicePrincipals {
+		members = append(members, sp)
+	}
 	return members, nil
 }
 
+// getServicePrincipalMembersPage gets the first page of the direct or transitive service principal members of a group
+func (g *GraphQuery) getServicePrincipalMembersPage(ctx context.Context, client *msgraphsdk.GraphServiceClient, groupID string, transitive bool) (models.ServicePrincipalCollectionResponseable, error) {
+	top := int32(memberPageSize)
+	if transitive {
+		return client.Groups().ByGroupId(groupID).TransitiveMembers().GraphServicePrincipal().Get(ctx, &groups.ItemTransitiveMembersGraphServicePrincipalRequestBuilderGetRequestConfiguration{
+			QueryParameters: &groups.ItemTransitiveMembersGraphServicePrincipalRequestBuilderGetQueryParameters{
+				Top: &top,
+			},
+		})
+	}
+	return client.Groups().ByGroupId(groupID).Members().GraphServicePrincipal().Get(ctx, &groups.ItemMembersGraphServicePrincipalRequestBuilderGetRequestConfiguration{
+		QueryParameters: &groups.ItemMembersGraphServicePrincipalRequestBuilderGetQueryParameters{
+			Top: &top,
+		},
+	})
+}
+
+// memberNesting describes how a transitive member belongs to the queried group
+type memberNesting struct {
+	depth      int
+	parentID   string
+	parentName string
+}
+
+// resolveMemberNesting walks the nested groups among the transitive members
+// breadth first, and returns the depth at which each member belongs to the
+// group and the group it is a direct member of. Members reachable through
+// several groups are attributed to the shallowest one.
+func (g *GraphQuery) resolveMemberNesting(ctx context.Context, client *msgraphsdk.GraphServiceClient, groupID string, groupName string, members []models.DirectoryObjectable, maxMembers int) (map[string]memberNesting, error) {
+	// Only groups among the transitive members need to be walked
+	nestedGroups := make(map[string]string)
+	for _, member := range members {
+		group, ok := member.(models.Groupable)
+		if !ok || group.GetId() == nil {
+			continue
+		}
+		var name string
+		if group.GetDisplayName() != nil {
+			name = *group.GetDisplayName()
+		}
+		nestedGroups[*group.GetId()] = name
+	}
+
+	type parentGroup struct {
+		id    string
+		name  string
+		depth int
+	}
+
+	nesting := make(map[string]memberNesting, len(members))
+	queue := []parentGroup{{id: groupID, name: groupName}}
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+
+		direct, _, err := g.fetchGroupMembers(ctx, client, parent.id, parent.name, maxMembers, false)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, member := range direct {
+			id := member.GetId()
+			if id == nil || *id == groupID {
+				continue
+			}
+			if _, seen := nesting[*id]; seen {
+				continue
+			}
+			nesting[*id] = memberNesting{depth: parent.depth + 1, parentID: parent.id, parentName: parent.name}
+
+			if name, ok := nestedGroups[*id]; ok {
+				queue = append(queue, parentGroup{id: *id, name: name, depth: parent.depth + 1})
+			}
+		}
+	}
+
+	return nesting, nil
+}
+
+// mergeMembers appends the additional members not already in members, up to
+// maxMembers. The returned bool reports whether members were left out.
+func mergeMembers(members, additional []models.DirectoryObjectable, maxMembers int) ([]models.DirectoryObjectable, bool) {
+	seen := make(map[string]bool, len(members))
+	for _, member := range members {
+		if id := member.GetId(); id != nil {
+			seen[*id] = true
+		}
+	}
+
+	for _, member := range additional {
+		id := member.GetId()
+		if id == nil || seen[*id] {
+			continue
+		}
+		if maxMembers > 0 && len(members) >= maxMembers {
+			return members, true
+		}
+		seen[*id] = true
+		members = append(members, member)
+	}
+	return members, false
+}
+
 // extractDisplayName attempts to extract the display name from a directory object
 func (g *GraphQuery) extractDisplayName(member models.DirectoryObjectable, memberID string) string {
 	additionalData := member.GetAdditionalData()
@@ -455,213 +794,1010 @@ func (g *GraphQuery) extractStringProperty(additionalData map[string]interface{}
 			return strVal, true
 		}
 	}
-	return "", false
+	return "", false
+}
+
+// extractUserProperties extracts user-specific properties from additionalData
+func (g *GraphQuery) extractUserProperties(additionalData map[string]interface{}, memberMap map[string]interface{}) {
+	// Extract mail property
+	if mail, ok := g.extractStringProperty(additionalData, "mail"); ok {
+		memberMap["mail"] = mail
+	}
+
+	// Extract userPrincipalName property
+	if upn, ok := g.extractStringProperty(additionalData, "userPrincipalName"); ok {
+		memberMap["userPrincipalName"] = upn
+	}
+}
+
+// extractServicePrincipalProperties extracts service principal specific properties
+func (g *GraphQuery) extractServicePrincipalProperties(additionalData map[string]interface{}, memberMap map[string]interface{}) {
+	// Extract appId property
+	if appID, ok := g.extractStringProperty(additionalData, "appId"); ok {
+		memberMap["appId"] = appID
+	}
+}
+
+// processMember extracts member information into a map
+func (g *GraphQuery) processMember(member models.DirectoryObjectable) map[string]interface{} {
+	// Define constants for member types
+	const (
+		userType             = "user"
+		servicePrincipalType = "servicePrincipal"
+		groupType            = "group"
+		unknownType          = "unknown"
+	)
+
+	memberID := member.GetId()
+	additionalData := member.GetAdditionalData()
+
+	// Create basic member info
+	memberMap := map[string]interface{}{
+		"id": optionalString(memberID),
+	}
+
+	// Determine member type
+	memberType := unknownType
+
+	// Check properties that indicate user type
+	_, hasUserPrincipalName := g.extractStringProperty(additionalData, "userPrincipalName")
+	_, hasMail := g.extractStringProperty(additionalData, "mail")
+	if hasUserPrincipalName || hasMail {
+		memberType = userType
+	}
+
+	// Check properties that indicate service principal type
+	_, hasAppID := g.extractStringProperty(additionalData, "appId")
+	if hasAppID {
+		memberType = servicePrincipalType
+	}
+
+	// Try interface type checking for more accuracy
+	if _, ok := member.(models.Userable); ok {
+		memberType = userType
+	}
+	if _, ok := member.(models.ServicePrincipalable); ok {
+		memberType = servicePrincipalType
+	}
+	if _, ok := member.(models.Groupable); ok {
+		memberType = groupType
+	}
+
+	// Add type to member info
+	memberMap["type"] = memberType
+
+	// Extract display name
+	memberMap["displayName"] = g.extractDisplayName(member, *memberID)
+
+	// Extract type-specific properties
+	switch memberType {
+	case userType:
+		g.extractUserProperties(additionalData, memberMap)
+	case servicePrincipalType:
+		g.extractServicePrincipalProperties(additionalData, memberMap)
+	}
+
+	return memberMap
+}
+
+// getGroupMembers retrieves all members of the specified group
+func (g *GraphQuery) getGroupMembers(ctx context.Context, client *msgraphsdk.GraphServiceClient, in *v1beta1.Input) (interface{}, error) {
+	// Determine the group name to use
+	var groupName string
+
+	// Check if we have a group name (either directly or resolved from GroupRef)
+	if in.Group != nil && *in.Group != "" {
+		groupName = *in.Group
+	} else {
+		return nil, errors.New("no group name provided")
+	}
+
+	// Find the group
+	group, err := g.findGroup(ctx, client, in, groupName)
+	if err != nil {
+		return nil, err
+	}
+	groupID := group.GetId()
+
+	maxMembers := defaultMaxMembers
+	if in.MaxMembers != nil {
+		maxMembers = *in.MaxMembers
+	}
+
+	transitive := in.Transitive != nil && *in.Transitive
+
+	// Fetch the members
+	memberObjects, truncated, err := g.fetchGroupMembers(ctx, client, *groupID, groupName, maxMembers, transitive)
+	if err != nil {
+		return nil, err
+	}
+	if truncated {
+		addQueryWarning(ctx, "GroupMembership results for group %s were truncated to maxMembers (%d)", groupName, maxMembers)
+	}
+
+	// Find out which group each transitive member came through, if asked to, as it costs requests per nested group
+	var nesting map[string]memberNesting
+	if transitive && in.ResolveNesting != nil && *in.ResolveNesting {
+		nesting, err = g.resolveMemberNesting(ctx, client, *groupID, groupName, memberObjects, maxMembers)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Process the members
+	members := make([]interface{}, 0, len(memberObjects))
+	for _, member := range memberObjects {
+		memberMap := g.processMember(member)
+		if id := member.GetId(); id != nil {
+			if n, ok := nesting[*id]; ok {
+				memberMap["depth"] = n.depth
+				memberMap["parentGroupId"] = n.parentID
+				memberMap["parentGroupName"] = n.parentName
+			}
+		}
+		members = append(members, memberMap)
+	}
+
+	return members, nil
+}
+
+// getGroupOwners retrieves the owners of the specified groups
+func (g *GraphQuery) getGroupOwners(ctx context.Context, client *msgraphsdk.GraphServiceClient, in *v1beta1.Input) (interface{}, error) {
+	if len(in.Groups) == 0 {
+		return nil, errors.New("no group names provided")
+	}
+
+	var results []interface{}
+
+	for _, groupName := range in.Groups {
+		if groupName == nil {
+			continue
+		}
+
+		// Find the group
+		group, err := g.findGroup(ctx, client, in, *groupName)
+		if err != nil {
+			return nil, err
+		}
+		groupID := group.GetId()
+
+		// Fetch the owners
+		ownerObjects, err := g.fetchGroupOwners(ctx, client, *groupID, *groupName)
+		if err != nil {
+			return nil, err
+		}
+
+		// Process the owners, which are users or service principals
+		owners := make([]interface{}, 0, len(ownerObjects))
+		for _, owner := range ownerObjects {
+			owners = append(owners, g.processMember(owner))
+		}
+
+		results = append(results, map[string]interface{}{
+			"id":          optionalString(groupID),
+			"displayName": optionalString(group.GetDisplayName()),
+			"owners":      owners,
+		})
+	}
+
+	return results, nil
+}
+
+// fetchGroupOwners fetches all owners of a group by group ID
+func (g *GraphQuery) fetchGroupOwners(ctx context.Context, client *msgraphsdk.GraphServiceClient, groupID string, groupName string) ([]models.DirectoryObjectable, error) {
+	firstPage, err := client.Groups().ByGroupId(groupID).Owners().Get(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get owners for group %s", groupName)
+	}
+
+	owners, _, err := collectPages[models.DirectoryObjectable](ctx, client, firstPage,
+		models.CreateDirectoryObjectCollectionResponseFromDiscriminatorValue, 0)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get owners for group %s", groupName)
+	}
+
+	if g.log != nil {
+		g.log.Debug("Retrieved group owners", "groupName", groupName, "groupID", groupID, "ownerCount", len(owners))
+	}
+
+	return owners, nil
+}
+
+// checkMembership checks which of the specified groups a user or service
+// principal is a direct or transitive member of, keyed by the group names
+func (g *GraphQuery) checkMembership(ctx context.Context, client *msgraphsdk.GraphServiceClient, in *v1beta1.Input) (interface{}, error) {
+	if in.Principal == nil || *in.Principal == "" {
+		return nil, errors.New("no principal provided")
+	}
+	if len(in.Groups) == 0 {
+		return nil, errors.New("no group names provided")
+	}
+
+	results := make(map[string]interface{})
+	namesByID := make(map[string][]string)
+	var groupIDs []string
+
+	// Find the group IDs, groups that do not exist are reported as not a member
+	for _, groupName := range in.Groups {
+		if groupName == nil {
+			continue
+		}
+		results[*groupName] = false
+
+		found, _, err := g.lookupGroups(ctx, client, lookupProperty(in, *groupName), *groupName, []string{"id"}, 1)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to find group %s", *groupName)
+		}
+		if len(found) == 0 || found[0].GetId() == nil {
+			addQueryWarning(ctx, "CheckMembership group %s was not found", *groupName)
+			continue
+		}
+
+		groupID := *found[0].GetId()
+		if _, ok := namesByID[groupID]; !ok {
+			groupIDs = append(groupIDs, groupID)
+		}
+		namesByID[groupID] = append(namesByID[groupID], *groupName)
+	}
+
+	// Find the principal
+	p, err := g.findPrincipal(ctx, client, in)
+	if err != nil {
+		return nil, err
+	}
+
+	memberGroupIDs, err := g.checkMemberGroups(ctx, client, p, groupIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, groupID := range memberGroupIDs {
+		for _, groupName := range namesByID[groupID] {
+			results[groupName] = true
+		}
+	}
+
+	return results, nil
+}
+
+// checkMemberGroupsBatchSize is the largest number of groups Microsoft Graph checks in one checkMemberGroups request
+const checkMemberGroupsBatchSize = 20
+
+// checkMemberGroups returns the IDs of the groups a principal is a direct or transitive member of
+func (g *GraphQuery) checkMemberGroups(ctx context.Context, client *msgraphsdk.GraphServiceClient, p principal, groupIDs []string) ([]string, error) {
+	var memberGroupIDs []string
+
+	// Check the groups in batches
+	for start := 0; start < len(groupIDs); start += checkMemberGroupsBatchSize {
+		batch := groupIDs[start:min(start+checkMemberGroupsBatchSize, len(groupIDs))]
+
+		var value []string
+		switch p.principalType {
+		case principalTypeServicePrincipal:
+			body := serviceprincipals.NewItemCheckMemberGroupsPostRequestBody()
+			body.SetGroupIds(batch)
+			result, err := client.ServicePrincipals().ByServicePrincipalId(p.id).CheckMemberGroups().PostAsCheckMemberGroupsPostResponse(ctx, body, nil)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to check group membership of %s", p.name)
+			}
+			value = result.GetValue()
+		case principalTypeGroup:
+			body := groups.NewItemCheckMemberGroupsPostRequestBody()
+			body.SetGroupIds(batch)
+			result, err := client.Groups().ByGroupId(p.id).CheckMemberGroups().PostAsCheckMemberGroupsPostResponse(ctx, body, nil)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to check group membership of %s", p.name)
+			}
+			value = result.GetValue()
+		default:
+			body := users.NewItemCheckMemberGroupsPostRequestBody()
+			body.SetGroupIds(batch)
+			result, err := client.Users().ByUserId(p.id).CheckMemberGroups().PostAsCheckMemberGroupsPostResponse(ctx, body, nil)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to check group membership of %s", p.name)
+			}
+			value = result.GetValue()
+		}
+		memberGroupIDs = append(memberGroupIDs, value...)
+	}
+
+	return memberGroupIDs, nil
+}
+
+const (
+	// principalTypeUser is a user, found by user principal name or ID
+	principalTypeUser = "User"
+	// principalTypeGroup is a group, found by display name or ID
+	principalTypeGroup = "Group"
+	// principalTypeServicePrincipal is a service principal, found by app ID
+	principalTypeServicePrincipal = "ServicePrincipal"
+)
+
+// principal is a user, group or service principal found by findPrincipal
+type principal struct {
+	id            string
+	name          string
+	principalType string
+}
+
+// findPrincipal finds the principal of the input. Without principalType, a
+// principal that is a GUID is the app ID of a service principal, and any other
+// principal is a user principal name. Users and groups given as GUIDs are
+// looked up by ID.
+func (g *GraphQuery) findPrincipal(ctx context.Context, client *msgraphsdk.GraphServiceClient, in *v1beta1.Input) (principal, error) {
+	name := *in.Principal
+
+	principalType := in.PrincipalType
+	if principalType == "" {
+		principalType = principalTypeUser
+		if isGUID(name) {
+			principalType = principalTypeServicePrincipal
+		}
+	}
+
+	var (
+		ids []*string
+		err error
+	)
+	switch principalType {
+	case principalTypeUser:
+		property := lookupByUserPrincipalName
+		if isGUID(name) {
+			property = lookupByID
+		}
+		var found []models.Userable
+		found, _, err = g.lookupUsers(ctx, client, property, name, []string{"id"}, 1)
+		for _, user := range found {
+			ids = append(ids, user.GetId())
+		}
+	case principalTypeGroup:
+		property := lookupByDisplayName
+		if isGUID(name) {
+			property = lookupByID
+		}
+		var found []models.Groupable
+		found, _, err = g.lookupGroups(ctx, client, property, name, []string{"id"}, 1)
+		for _, group := range found {
+			ids = append(ids, group.GetId())
+		}
+	case principalTypeServicePrincipal:
+		var found []models.ServicePrincipalable
+		found, _, err = g.lookupServicePrincipals(ctx, client, lookupByAppID, name, []string{"id"}, 1)
+		for _, sp := range found {
+			ids = append(ids, sp.GetId())
+		}
+	default:
+		return principal{}, errors.Errorf("unsupported principalType: %s", principalType)
+	}
+	if err != nil {
+		return principal{}, errors.Wrapf(err, "failed to find principal %s", name)
+	}
+	if len(ids) == 0 || ids[0] == nil {
+		return principal{}, errors.Errorf("principal not found: %s", name)
+	}
+
+	return principal{id: *ids[0], name: name, principalType: principalType}, nil
+}
+
+// getDirectoryRoleAssignments retrieves the directory role assignments held by
+// the principal of the input, or, if the input names a role instead, the
+// assignments of that role along with the principals holding it
+func (g *GraphQuery) getDirectoryRoleAssignments(ctx context.Context, client *msgraphsdk.GraphServiceClient, in *v1beta1.Input) (interface{}, error) {
+	hasPrincipal := in.Principal != nil && *in.Principal != ""
+	hasRole := in.Role != nil && *in.Role != ""
+
+	switch {
+	case hasPrincipal && hasRole:
+		return nil, errors.New("only one of principal and role can be provided")
+	case hasPrincipal:
+		return g.getPrincipalRoleAssignments(ctx, client, in)
+	case hasRole:
+		return g.getRoleHolders(ctx, client, in)
+	}
+	return nil, errors.New("no principal or role provided")
+}
+
+// getPrincipalRoleAssignments retrieves the directory role assignments held by the principal of the input
+func (g *GraphQuery) getPrincipalRoleAssignments(ctx context.Context, client *msgraphsdk.GraphServiceClient, in *v1beta1.Input) (interface{}, error) {
+	// Find the principal
+	p, err := g.findPrincipal(ctx, client, in)
+	if err != nil {
+		return nil, err
+	}
+
+	filterValue, err := eqFilter("principalId", p.id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get role assignments of %s", p.name)
+	}
+
+	assignments, err := g.fetchRoleAssignments(ctx, client, in, filterValue, "roleDefinition")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get role assignments of %s", p.name)
+	}
+
+	results := make([]interface{}, 0, len(assignments))
+	for _, assignment := range assignments {
+		results = append(results, roleAssignmentDetails(assignment, assignment.GetRoleDefinition()))
+	}
+
+	return results, nil
+}
+
+// getRoleHolders retrieves the assignments of the role of the input, along with the principals holding it
+func (g *GraphQuery) getRoleHolders(ctx context.Context, client *msgraphsdk.GraphServiceClient, in *v1beta1.Input) (interface{}, error) {
+	// Find the role
+	role, err := g.findRoleDefinition(ctx, client, *in.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	filterValue, err := eqFilter("roleDefinitionId", *role.GetId())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get assignments of role %s", *in.Role)
+	}
+
+	assignments, err := g.fetchRoleAssignments(ctx, client, in, filterValue, "principal")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get assignments of role %s", *in.Role)
+	}
+
+	results := make([]interface{}, 0, len(assignments))
+	for _, assignment := range assignments {
+		assignmentMap := roleAssignmentDetails(assignment, role)
+		if member := assignment.GetPrincipal(); member != nil && member.GetId() != nil {
+			assignmentMap["principal"] = g.processMember(member)
+		}
+		results = append(results, assignmentMap)
+	}
+
+	return results, nil
+}
+
+// fetchRoleAssignments fetches the directory role assignments matching a filter, up to the results limit
+func (g *GraphQuery) fetchRoleAssignments(ctx context.Context, client *msgraphsdk.GraphServiceClient, in *v1beta1.Input, filter string, expand string) ([]models.UnifiedRoleAssignmentable, error) {
+	firstPage, err := client.RoleManagement().Directory().RoleAssignments().Get(ctx, &rolemanagement.DirectoryRoleAssignmentsRequestBuilderGetRequestConfiguration{
+		QueryParameters: &rolemanagement.DirectoryRoleAssignmentsRequestBuilderGetQueryParameters{
+			Filter: &filter,
+			Expand: []string{expand},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	limit := newResultLimit(in)
+	assignments, truncated, err := collectPages[models.UnifiedRoleAssignmentable](ctx, client, firstPage,
+		models.CreateUnifiedRoleAssignmentCollectionResponseFromDiscriminatorValue, int(limit))
+	if err != nil {
+		return nil, err
+	}
+	if truncated {
+		limit.warn(ctx, in.QueryType)
+	}
+
+	return assignments, nil
+}
+
+// findRoleDefinition finds a directory role definition by its display name, or by ID if the name is a GUID
+func (g *GraphQuery) findRoleDefinition(ctx context.Context, client *msgraphsdk.GraphServiceClient, roleName string) (models.UnifiedRoleDefinitionable, error) {
+	property := lookupByDisplayName
+	if isGUID(roleName) {
+		property = lookupByID
+	}
+	selectFields := []string{"id", "displayName", "templateId", "isBuiltIn"}
+
+	found, _, err := lookupObjects(ctx, client, property, roleName, 1,
+		func(id string) (models.UnifiedRoleDefinitionable, error) {
+			return client.RoleManagement().Directory().RoleDefinitions().ByUnifiedRoleDefinitionId(id).Get(ctx, &rolemanagement.DirectoryRoleDefinitionsUnifiedRoleDefinitionItemRequestBuilderGetRequestConfiguration{
+				QueryParameters: &rolemanagement.DirectoryRoleDefinitionsUnifiedRoleDefinitionItemRequestBuilderGetQueryParameters{Select: selectFields},
+			})
+		},
+		func(filter string) (interface{}, error) {
+			return client.RoleManagement().Directory().RoleDefinitions().Get(ctx, &rolemanagement.DirectoryRoleDefinitionsRequestBuilderGetRequestConfiguration{
+				QueryParameters: &rolemanagement.DirectoryRoleDefinitionsRequestBuilderGetQueryParameters{Filter: &filter, Select: selectFields},
+			})
+		},
+		models.CreateUnifiedRoleDefinitionCollectionResponseFromDiscriminatorValue)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find role %s", roleName)
+	}
+	if len(found) == 0 || found[0].GetId() == nil {
+		return nil, errors.Errorf("role not found: %s", roleName)
+	}
+
+	return found[0], nil
+}
+
+// roleAssignmentDetails extracts role assignment information into a map
+func roleAssignmentDetails(assignment models.UnifiedRoleAssignmentable, role models.UnifiedRoleDefinitionable) map[string]interface{} {
+	assignmentMap := map[string]interface{}{
+		"id":               optionalString(assignment.GetId()),
+		"principalId":      optionalString(assignment.GetPrincipalId()),
+		"roleDefinitionId": optionalString(assignment.GetRoleDefinitionId()),
+		"directoryScopeId": optionalString(assignment.GetDirectoryScopeId()),
+	}
+	if role != nil {
+		assignmentMap["roleName"] = optionalString(role.GetDisplayName())
+		assignmentMap["roleTemplateId"] = optionalString(role.GetTemplateId())
+		assignmentMap["isBuiltIn"] = optionalBool(role.GetIsBuiltIn())
+	}
+	return assignmentMap
+}
+
+// getAppRoleAssignments retrieves the app roles granted to the service principals
+// of the input, only those on the resource if the input names one too. Given
+// only a resource, it retrieves the app roles granted on the resource instead.
+func (g *GraphQuery) getAppRoleAssignments(ctx context.Context, client *msgraphsdk.GraphServiceClient, in *v1beta1.Input) (interface{}, error) {
+	hasResource := in.Resource != nil && *in.Resource != ""
+	if len(in.ServicePrincipals) == 0 && !hasResource {
+		return nil, errors.New("no service principal names or resource provided")
+	}
+
+	resolver := &appRoleResolver{g: g, client: client, roles: make(map[string]map[string]models.AppRoleable)}
+
+	// Find the resource
+	var resourceID string
+	if hasResource {
+		resource, err := g.findResource(ctx, client, *in.Resource)
+		if err != nil {
+			return nil, err
+		}
+		resourceID = *resource.GetId()
+		resolver.add(resource)
+	}
+
+	var results []interface{}
+	limit := newResultLimit(in)
+
+	// List the app roles granted on the resource
+	if len(in.ServicePrincipals) == 0 {
+		assignments, truncated, err := g.fetchAppRoleAssignments(ctx, client, resourceID, true, "", int(limit))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get app role assignments on %s", *in.Resource)
+		}
+		for _, assignment := range assignments {
+			results = append(results, appRoleAssignmentDetails(assignment, resolver.role(ctx, assignment)))
+		}
+		if truncated {
+			limit.warn(ctx, in.QueryType)
+		}
+		return results, nil
+	}
+
+	for i, spName := range in.ServicePrincipals {
+		if spName == nil {
+			continue
+		}
+
+		// Find the service principals, several may share a display name
+		found, _, err := g.lookupServicePrincipals(ctx, client, lookupProperty(in, *spName), *spName, []string{"id"}, 0)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to find service principal %s", *spName)
+		}
+
+		truncated := false
+		for j, sp := range found {
+			if sp.GetId() == nil {
+				continue
+			}
+
+			var assignments []models.AppRoleAssignmentable
+			assignments, truncated, err = g.fetchAppRoleAssignments(ctx, client, *sp.GetId(), false, resourceID, limit.remaining(len(results)))
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to get app role assignments of %s", *spName)
+			}
+			for _, assignment := range assignments {
+				results = append(results, appRoleAssignmentDetails(assignment, resolver.role(ctx, assignment)))
+			}
+			if truncated || (limit.reached(len(results)) && j < len(found)-1) {
+				truncated = true
+				break
+			}
+		}
+
+		if truncated || (limit.reached(len(results)) && i < len(in.ServicePrincipals)-1) {
+			limit.warn(ctx, in.QueryType)
+			break
+		}
+	}
+
+	return results, nil
 }
 
-// extractUserProperties extracts user-specific properties from additionalData
-func (g *GraphQuery) extractUserProperties(additionalData map[string]interface{}, memberMap map[string]interface{}) {
-	// Extract mail property
-	if mail, ok := g.extractStringProperty(additionalData, "mail"); ok {
-		memberMap["mail"] = mail
+// findResource finds the resource service principal of an app role assignment
+// query by its app ID if the name is a GUID, and by its display name otherwise
+func (g *GraphQuery) findResource(ctx context.Context, client *msgraphsdk.GraphServiceClient, resourceName string) (models.ServicePrincipalable, error) {
+	property := lookupByDisplayName
+	if isGUID(resourceName) {
+		property = lookupByAppID
 	}
 
-	// Extract userPrincipalName property
-	if upn, ok := g.extractStringProperty(additionalData, "userPrincipalName"); ok {
-		memberMap["userPrincipalName"] = upn
+	found, _, err := g.lookupServicePrincipals(ctx, client, property, resourceName, []string{"id", "appId", "displayName", "appRoles"}, 1)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find resource %s", resourceName)
 	}
-}
-
-// extractServicePrincipalProperties extracts service principal specific properties
-func (g *GraphQuery) extractServicePrincipalProperties(additionalData map[string]interface{}, memberMap map[string]interface{}) {
-	// Extract appId property
-	if appID, ok := g.extractStringProperty(additionalData, "appId"); ok {
-		memberMap["appId"] = appID
+	if len(found) == 0 || found[0].GetId() == nil {
+		return nil, errors.Errorf("resource not found: %s", resourceName)
 	}
+
+	return found[0], nil
 }
 
-// processMember extracts member information into a map
-func (g *GraphQuery) processMember(member models.DirectoryObjectable) map[string]interface{} {
-	// Define constants for member types
-	const (
-		userType             = "user"
-		servicePrincipalType = "servicePrincipal"
-		unknownType          = "unknown"
+// fetchAppRoleAssignments fetches the app roles granted to a service principal,
+// or with assignedTo, the app roles granted on it, up to limit. Granted app
+// roles are only those on the resource with resourceID, unless it is empty.
+func (g *GraphQuery) fetchAppRoleAssignments(ctx context.Context, client *msgraphsdk.GraphServiceClient, spID string, assignedTo bool, resourceID string, limit int) ([]models.AppRoleAssignmentable, bool, error) {
+	var (
+		firstPage models.AppRoleAssignmentCollectionResponseable
+		err       error
 	)
-
-	memberID := member.GetId()
-	additionalData := member.GetAdditionalData()
-
-	// Create basic member info
-	memberMap := map[string]interface{}{
-		"id": memberID,
+	if assignedTo {
+		firstPage, err = client.ServicePrincipals().ByServicePrincipalId(spID).AppRoleAssignedTo().Get(ctx, nil)
+	} else {
+		requestConfig := &serviceprincipals.ItemAppRoleAssignmentsRequestBuilderGetRequestConfiguration{
+			QueryParameters: &serviceprincipals.ItemAppRoleAssignmentsRequestBuilderGetQueryParameters{},
+		}
+		if resourceID != "" {
+			filterValue, err := guidFilter("resourceId", resourceID)
+			if err != nil {
+				return nil, false, err
+			}
+			requestConfig.QueryParameters.Filter = &filterValue
+		}
+		firstPage, err = client.ServicePrincipals().ByServicePrincipalId(spID).AppRoleAssignments().Get(ctx, requestConfig)
+	}
+	if err != nil {
+		return nil, false, err
 	}
 
-	// Determine member type
-	memberType := unknownType
+	return collectPages[models.AppRoleAssignmentable](ctx, client, firstPage,
+		models.CreateAppRoleAssignmentCollectionResponseFromDiscriminatorValue, limit)
+}
 
-	// Check properties that indicate user type
-	_, hasUserPrincipalName := g.extractStringProperty(additionalData, "userPrincipalName")
-	_, hasMail := g.extractStringProperty(additionalData, "mail")
-	if hasUserPrincipalName || hasMail {
-		memberType = userType
-	}
+// appRoleResolver resolves the app roles of app role assignments, reading the
+// app roles of each resource service principal once
+type appRoleResolver struct {
+	g      *GraphQuery
+	client *msgraphsdk.GraphServiceClient
+	// roles holds the app roles of each resource by resource ID and app role ID
+	roles map[string]map[string]models.AppRoleable
+}
 
-	// Check properties that indicate service principal type
-	_, hasAppID := g.extractStringProperty(additionalData, "appId")
-	if hasAppID {
-		memberType = servicePrincipalType
+// add records the app roles of a resource service principal
+func (r *appRoleResolver) add(resource models.ServicePrincipalable) {
+	roles := make(map[string]models.AppRoleable)
+	for _, role := range resource.GetAppRoles() {
+		if role.GetId() != nil {
+			roles[role.GetId().String()] = role
+		}
 	}
+	r.roles[*resource.GetId()] = roles
+}
 
-	// Try interface type checking for more accuracy
-	if _, ok := member.(models.Userable); ok {
-		memberType = userType
+// role returns the app role granted by an assignment, or nil if it cannot be
+// resolved, such as for the default access role, which has an all zero ID
+func (r *appRoleResolver) role(ctx context.Context, assignment models.AppRoleAssignmentable) models.AppRoleable {
+	if assignment.GetResourceId() == nil || assignment.GetAppRoleId() == nil {
+		return nil
 	}
-	if _, ok := member.(models.ServicePrincipalable); ok {
-		memberType = servicePrincipalType
+	resourceID := assignment.GetResourceId().String()
+
+	if _, ok := r.roles[resourceID]; !ok {
+		found, _, err := r.g.lookupServicePrincipals(ctx, r.client, lookupByID, resourceID, []string{"id", "appRoles"}, 1)
+		if err != nil || len(found) == 0 || found[0].GetId() == nil {
+			// Leave the role unresolved rather than fail the query
+			addQueryWarning(ctx, "AppRoleAssignments could not read the app roles of resource %s", resourceID)
+			r.roles[resourceID] = nil
+			return nil
+		}
+		r.add(found[0])
 	}
 
-	// Add type to member info
-	memberMap["type"] = memberType
+	return r.roles[resourceID][assignment.GetAppRoleId().String()]
+}
 
-	// Extract display name
-	memberMap["displayName"] = g.extractDisplayName(member, *memberID)
+// appRoleAssignmentDetails extracts app role assignment information into a map
+func appRoleAssignmentDetails(assignment models.AppRoleAssignmentable, role models.AppRoleable) map[string]interface{} {
+	assignmentMap := map[string]interface{}{
+		"id":                   optionalString(assignment.GetId()),
+		"principalId":          optionalUUID(assignment.GetPrincipalId()),
+		"principalDisplayName": optionalString(assignment.GetPrincipalDisplayName()),
+		"principalType":        optionalString(assignment.GetPrincipalType()),
+		"resourceId":           optionalUUID(assignment.GetResourceId()),
+		"resourceDisplayName":  optionalString(assignment.GetResourceDisplayName()),
+		"appRoleId":            optionalUUID(assignment.GetAppRoleId()),
+		"appRoleValue":         nil,
+		"appRoleDisplayName":   nil,
+		"createdDateTime":      optionalTime(assignment.GetCreatedDateTime()),
+	}
+	if role != nil {
+		assignmentMap["appRoleValue"] = optionalString(role.GetValue())
+		assignmentMap["appRoleDisplayName"] = optionalString(role.GetDisplayName())
+	}
+	return assignmentMap
+}
 
-	// Extract type-specific properties
-	switch memberType {
-	case userType:
-		g.extractUserProperties(additionalData, memberMap)
-	case servicePrincipalType:
-		g.extractServicePrincipalProperties(additionalData, memberMap)
+// getOAuth2PermissionGrants retrieves the delegated permission grants of the
+// specified service principals, which are the clients of the grants
+func (g *GraphQuery) getOAuth2PermissionGrants(ctx context.Context, client *msgraphsdk.GraphServiceClient, in *v1beta1.Input) (interface{}, error) {
+	if len(in.ServicePrincipals) == 0 {
+		return nil, errors.New("no service principal names provided")
 	}
 
-	return memberMap
-}
+	var results []interface{}
+	limit := newResultLimit(in)
 
-// getGroupMembers retrieves all members of the specified group
-func (g *GraphQuery) getGroupMembers(ctx context.Context, client *msgraphsdk.GraphServiceClient, in *v1beta1.Input) (interface{}, error) {
-	// Determine the group name to use
-	var groupName string
+	for i, spName := range in.ServicePrincipals {
+		if spName == nil {
+			continue
+		}
 
-	// Check if we have a group name (either directly or resolved from GroupRef)
-	if in.Group != nil && *in.Group != "" {
-		groupName = *in.Group
-	} else {
-		return nil, errors.New("no group name provided")
-	}
+		// Find the service principals, several may share a display name
+		found, _, err := g.lookupServicePrincipals(ctx, client, lookupProperty(in, *spName), *spName, []string{"id"}, 0)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to find service principal %s", *spName)
+		}
 
-	// Find the group
-	groupID, err := g.findGroupByName(ctx, client, groupName)
-	if err != nil {
-		return nil, err
+		truncated := false
+		for j, sp := range found {
+			if sp.GetId() == nil {
+				continue
+			}
+
+			var grants []models.OAuth2PermissionGrantable
+			grants, truncated, err = g.fetchOAuth2PermissionGrants(ctx, client, *sp.GetId(), limit.remaining(len(results)))
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to get delegated permission grants of %s", *spName)
+			}
+			for _, grant := range grants {
+				results = append(results, oauth2PermissionGrantDetails(grant))
+			}
+			if truncated || (limit.reached(len(results)) && j < len(found)-1) {
+				truncated = true
+				break
+			}
+		}
+
+		if truncated || (limit.reached(len(results)) && i < len(in.ServicePrincipals)-1) {
+			limit.warn(ctx, in.QueryType)
+			break
+		}
 	}
 
-	// Fetch the members
-	memberObjects, err := g.fetchGroupMembers(ctx, client, *groupID, groupName)
+	return results, nil
+}
+
+// fetchOAuth2PermissionGrants fetches the delegated permission grants whose
+// client is the service principal with spID, up to limit
+func (g *GraphQuery) fetchOAuth2PermissionGrants(ctx context.Context, client *msgraphsdk.GraphServiceClient, spID string, limit int) ([]models.OAuth2PermissionGrantable, bool, error) {
+	firstPage, err := client.ServicePrincipals().ByServicePrincipalId(spID).Oauth2PermissionGrants().Get(ctx, nil)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	// Process the members
-	members := make([]interface{}, 0, len(memberObjects))
-	for _, member := range memberObjects {
-		memberMap := g.processMember(member)
-		members = append(members, memberMap)
+	return collectPages[models.OAuth2PermissionGrantable](ctx, client, firstPage,
+		models.CreateOAuth2PermissionGrantCollectionResponseFromDiscriminatorValue, limit)
+}
+
+// oauth2PermissionGrantDetails extracts delegated permission grant information
+// into a map. The space separated scope is also split into a list of scopes.
+func oauth2PermissionGrantDetails(grant models.OAuth2PermissionGrantable) map[string]interface{} {
+	scopes := []interface{}{}
+	if grant.GetScope() != nil {
+		scopes = stringList(strings.Fields(*grant.GetScope()))
 	}
 
-	return members, nil
+	return map[string]interface{}{
+		"id":          optionalString(grant.GetId()),
+		"clientId":    optionalString(grant.GetClientId()),
+		"resourceId":  optionalString(grant.GetResourceId()),
+		"principalId": optionalString(grant.GetPrincipalId()),
+		"consentType": optionalString(grant.GetConsentType()),
+		"scope":       optionalString(grant.GetScope()),
+		"scopes":      scopes,
+	}
 }
 
-// getGroupObjectIDs retrieves object IDs for the specified group names
+// getGroupObjectIDs retrieves object IDs for the specified group names or IDs
 func (g *GraphQuery) getGroupObjectIDs(ctx context.Context, client *msgraphsdk.GraphServiceClient, in *v1beta1.Input) (interface{}, error) {
 	if len(in.Groups) == 0 {
 		return nil, errors.New("no group names provided")
 	}
 
 	var results []interface{}
+	limit := newResultLimit(in)
+	fields := selectedFields(in)
 
-	for _, groupName := range in.Groups {
+	for i, groupName := range in.Groups {
 		if groupName == nil {
 			continue
 		}
 
-		// Create request configuration
-		requestConfig := &groups.GroupsRequestBuilderGetRequestConfiguration{
-			QueryParameters: &groups.GroupsRequestBuilderGetQueryParameters{},
-		}
-
-		// Find the group by displayName
-		filterValue := fmt.Sprintf("displayName eq '%s'", *groupName)
-		requestConfig.QueryParameters.Filter = &filterValue
-
-		// Use standard fields for group object IDs
-		requestConfig.QueryParameters.Select = []string{"id", "displayName", "description"}
-
-		groupResult, err := client.Groups().Get(ctx, requestConfig)
+		// Find the group with the selected fields, following the result pages up to the remaining results limit
+		found, truncated, err := g.lookupGroups(ctx, client, lookupProperty(in, *groupName), *groupName,
+			fields, limit.remaining(len(results)))
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to find group %s", *groupName)
 		}
 
-		if groupResult.GetValue() != nil && len(groupResult.GetValue()) > 0 {
-			for _, group := range groupResult.GetValue() {
-				groupMap := map[string]interface{}{
-					"id":          group.GetId(),
-					"displayName": group.GetDisplayName(),
-					"description": group.GetDescription(),
-				}
-				results = append(results, groupMap)
-			}
+		for _, group := range found {
+			results = append(results, selectedValues(group, fields))
+		}
+
+		if truncated || (limit.reached(len(results)) && i < len(in.Groups)-1) {
+			limit.warn(ctx, in.QueryType)
+			break
 		}
 	}
 
 	return results, nil
 }
 
-// getServicePrincipalDetails retrieves details about service principals by name
+// getServicePrincipalDetails retrieves details about service principals by name, app ID or ID
 func (g *GraphQuery) getServicePrincipalDetails(ctx context.Context, client *msgraphsdk.GraphServiceClient, in *v1beta1.Input) (interface{}, error) {
 	if len(in.ServicePrincipals) == 0 {
 		return nil, errors.New("no service principal names provided")
 	}
 
 	var results []interface{}
+	limit := newResultLimit(in)
+	fields := selectedFields(in)
 
-	for _, spName := range in.ServicePrincipals {
+	for i, spName := range in.ServicePrincipals {
 		if spName == nil {
 			continue
 		}
 
-		// Create request configuration
-		requestConfig := &serviceprincipals.ServicePrincipalsRequestBuilderGetRequestConfiguration{
-			QueryParameters: &serviceprincipals.ServicePrincipalsRequestBuilderGetQueryParameters{},
+		// Find the service principal with the selected fields, following the result pages up to the remaining results limit
+		found, truncated, err := g.lookupServicePrincipals(ctx, client, lookupProperty(in, *spName), *spName,
+			fields, limit.remaining(len(results)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to find service principal %s", *spName)
+		}
+
+		for _, sp := range found {
+			results = append(results, selectedValues(sp, fields))
 		}
 
-		// Find service principal by displayName
-		filterValue := fmt.Sprintf("displayName eq '%s'", *spName)
-		requestConfig.QueryParameters.Filter = &filterValue
+		if truncated || (limit.reached(len(results)) && i < len(in.ServicePrincipals)-1) {
+			limit.warn(ctx, in.QueryType)
+			break
+		}
+	}
+
+	return results, nil
+}
+
+// lookupServicePrincipals looks up the service principals whose property equals value, up to limit
+func (g *GraphQuery) lookupServicePrincipals(ctx context.Context, client *msgraphsdk.GraphServiceClient, property, value string, selectFields []string, limit int) ([]models.ServicePrincipalable, bool, error) {
+	return lookupObjects(ctx, client, property, value, limit,
+		func(id string) (models.ServicePrincipalable, error) {
+			return client.ServicePrincipals().ByServicePrincipalId(id).Get(ctx, &serviceprincipals.ServicePrincipalItemRequestBuilderGetRequestConfiguration{
+				QueryParameters: &serviceprincipals.ServicePrincipalItemRequestBuilderGetQueryParameters{Select: selectFields},
+			})
+		},
+		func(filter string) (interface{}, error) {
+			return client.ServicePrincipals().Get(ctx, &serviceprincipals.ServicePrincipalsRequestBuilderGetRequestConfiguration{
+				QueryParameters: &serviceprincipals.ServicePrincipalsRequestBuilderGetQueryParameters{Filter: &filter, Select: selectFields},
+			})
+		},
+		models.CreateServicePrincipalCollectionResponseFromDiscriminatorValue)
+}
+
+// getApplicationDetails retrieves details about application registrations by display name, app ID or ID
+func (g *GraphQuery) getApplicationDetails(ctx context.Context, client *msgraphsdk.GraphServiceClient, in *v1beta1.Input) (interface{}, error) {
+	if len(in.Applications) == 0 {
+		return nil, errors.New("no application names provided")
+	}
+
+	var results []interface{}
+	limit := newResultLimit(in)
+
+	for i, appName := range in.Applications {
+		if appName == nil {
+			continue
+		}
 
-		// Use standard fields for service principals
-		requestConfig.QueryParameters.Select = []string{"id", "appId", "displayName", "description"}
+		// Use standard fields for applications
+		selectFields := []string{
+			"id", "appId", "displayName", "identifierUris", "signInAudience",
+			"requiredResourceAccess", "appRoles", "passwordCredentials", "keyCredentials",
+		}
 
-		spResult, err := client.ServicePrincipals().Get(ctx, requestConfig)
+		// Find the application, following the result pages up to the remaining results limit
+		found, truncated, err := lookupObjects(ctx, client, lookupProperty(in, *appName), *appName, limit.remaining(len(results)),
+			func(id string) (models.Applicationable, error) {
+				return client.Applications().ByApplicationId(id).Get(ctx, &applications.ApplicationItemRequestBuilderGetRequestConfiguration{
+					QueryParameters: &applications.ApplicationItemRequestBuilderGetQueryParameters{Select: selectFields},
+				})
+			},
+			func(filter string) (interface{}, error) {
+				return client.Applications().Get(ctx, &applications.ApplicationsRequestBuilderGetRequestConfiguration{
+					QueryParameters: &applications.ApplicationsRequestBuilderGetQueryParameters{Filter: &filter, Select: selectFields},
+				})
+			},
+			models.CreateApplicationCollectionResponseFromDiscriminatorValue)
 		if err != nil {
-			return nil, errors.Wrapf(err, "failed to find service principal %s", *spName)
+			return nil, errors.Wrapf(err, "failed to find application %s", *appName)
 		}
 
-		if spResult.GetValue() != nil && len(spResult.GetValue()) > 0 {
-			for _, sp := range spResult.GetValue() {
-				spMap := map[string]interface{}{
-					"id":          sp.GetId(),
-					"appId":       sp.GetAppId(),
-					"displayName": sp.GetDisplayName(),
-					"description": sp.GetDescription(),
-				}
-				results = append(results, spMap)
-			}
+		for _, app := range found {
+			results = append(results, applicationDetails(app))
+		}
+
+		if truncated || (limit.reached(len(results)) && i < len(in.Applications)-1) {
+			limit.warn(ctx, in.QueryType)
+			break
 		}
 	}
 
 	return results, nil
 }
 
+// applicationDetails extracts application information into a map
+func applicationDetails(app models.Applicationable) map[string]interface{} {
+	requiredResourceAccess := make([]interface{}, 0, len(app.GetRequiredResourceAccess()))
+	for _, rra := range app.GetRequiredResourceAccess() {
+		resourceAccess := make([]interface{}, 0, len(rra.GetResourceAccess()))
+		for _, ra := range rra.GetResourceAccess() {
+			resourceAccess = append(resourceAccess, map[string]interface{}{
+				"id":   optionalUUID(ra.GetId()),
+				"type": optionalString(ra.GetTypeEscaped()),
+			})
+		}
+		requiredResourceAccess = append(requiredResourceAccess, map[string]interface{}{
+			"resourceAppId":  optionalString(rra.GetResourceAppId()),
+			"resourceAccess": resourceAccess,
+		})
+	}
+
+	appRoles := make([]interface{}, 0, len(app.GetAppRoles()))
+	for _, role := range app.GetAppRoles() {
+		appRoles = append(appRoles, map[string]interface{}{
+			"id":                 optionalUUID(role.GetId()),
+			"value":              optionalString(role.GetValue()),
+			"displayName":        optionalString(role.GetDisplayName()),
+			"description":        optionalString(role.GetDescription()),
+			"allowedMemberTypes": stringList(role.GetAllowedMemberTypes()),
+			"isEnabled":          optionalBool(role.GetIsEnabled()),
+		})
+	}
+
+	// Only the metadata of credentials is returned, never their secrets
+	passwordCredentials := make([]interface{}, 0, len(app.GetPasswordCredentials()))
+	for _, cred := range app.GetPasswordCredentials() {
+		passwordCredentials = append(passwordCredentials, map[string]interface{}{
+			"keyId":         optionalUUID(cred.GetKeyId()),
+			"displayName":   optionalString(cred.GetDisplayName()),
+			"startDateTime": optionalTime(cred.GetStartDateTime()),
+			"endDateTime":   optionalTime(cred.GetEndDateTime()),
+		})
+	}
+
+	keyCredentials := make([]interface{}, 0, len(app.GetKeyCredentials()))
+	for _, cred := range app.GetKeyCredentials() {
+		keyCredentials = append(keyCredentials, map[string]interface{}{
+			"keyId":         optionalUUID(cred.GetKeyId()),
+			"displayName":   optionalString(cred.GetDisplayName()),
+			"type":          optionalString(cred.GetTypeEscaped()),
+			"usage":         optionalString(cred.GetUsage()),
+			"startDateTime": optionalTime(cred.GetStartDateTime()),
+			"endDateTime":   optionalTime(cred.GetEndDateTime()),
+		})
+	}
+
+	return map[string]interface{}{
+		"id":                     optionalString(app.GetId()),
+		"appId":                  optionalString(app.GetAppId()),
+		"displayName":            optionalString(app.GetDisplayName()),
+		"identifierUris":         stringList(app.GetIdentifierUris()),
+		"signInAudience":         optionalString(app.GetSignInAudience()),
+		"requiredResourceAccess": requiredResourceAccess,
+		"appRoles":               appRoles,
+		"passwordCredentials":    passwordCredentials,
+		"keyCredentials":         keyCredentials,
+	}
+}
+
 // ParseNestedKey enables the bracket and dot notation to key reference
 func ParseNestedKey(key string) ([]string, error) {
 	var parts []string
@@ -903,6 +2039,64 @@ func (f *Function) validateAndPrepareInput(_ context.Context, req *fnv1.RunFunct
 		return false
 	}
 
+	// Check if onMissing is valid
+	if !isValidOnMissing(in.OnMissing) {
+		response.Fatal(rsp, errors.Errorf("unsupported onMissing: %s", in.OnMissing))
+		return false
+	}
+
+	// Check if the query type can look up names by lookupBy
+	if !isValidLookupBy(in.QueryType, in.LookupBy) {
+		response.Fatal(rsp, errors.Errorf("unsupported lookupBy %s for query type %s", in.LookupBy, in.QueryType))
+		return false
+	}
+
+	// Check if maxMembers is positive, a limit below 1 would not limit the members returned
+	if in.MaxMembers != nil && *in.MaxMembers < 1 {
+		response.Fatal(rsp, errors.Errorf("invalid maxMembers %d: must be at least 1", *in.MaxMembers))
+		return false
+	}
+
+	// Check if maxResults is positive, a limit below 1 would not limit the results returned
+	if in.MaxResults != nil && *in.MaxResults < 1 {
+		response.Fatal(rsp, errors.Errorf("invalid maxResults %d: must be at least 1", *in.MaxResults))
+		return false
+	}
+
+	// Check if top is positive, Microsoft Graph rejects a $top below 1
+	if in.Top != nil && *in.Top < 1 {
+		response.Fatal(rsp, errors.Errorf("invalid top %d: must be at least 1", *in.Top))
+		return false
+	}
+
+	// Check if the selected properties are property names
+	if field, ok := isValidSelect(in.Select); !ok {
+		response.Fatal(rsp, errors.Errorf("invalid select property %q", field))
+		return false
+	}
+
+	// Check if the results are sorted by a property name
+	if in.SortBy != nil && *in.SortBy != "" {
+		if _, ok := isValidSelect([]string{*in.SortBy}); !ok {
+			response.Fatal(rsp, errors.Errorf("invalid sortBy property %q", *in.SortBy))
+			return false
+		}
+	}
+
+	// Check if the query type supports the output format
+	if !isValidOutputFormat(in.QueryType, in.OutputFormat) {
+		response.Fatal(rsp, errors.Errorf("unsupported outputFormat %s for query type %s", in.OutputFormat, in.QueryType))
+		return false
+	}
+
+	// Check if the transform compiles, before running the query
+	if in.Transform != nil && *in.Transform != "" {
+		if _, err := compileTransform(*in.Transform); err != nil {
+			response.Fatal(rsp, err)
+			return false
+		}
+	}
+
 	// Check if we should skip the query
 	if f.shouldSkipQuery(req, in, rsp) {
 		// Set success condition
@@ -919,18 +2113,26 @@ func (f *Function) validateAndPrepareInput(_ context.Context, req *fnv1.RunFunct
 	return true
 }
 
-// processReferences handles resolving references like groupRef, groupsRef, usersRef, and servicePrincipalsRef
+// processReferences handles resolving references like groupRef, groupsRef, usersRef, servicePrincipalsRef, principalRef, roleRef and resourceRef
 func (f *Function) processReferences(req *fnv1.RunFunctionRequest, in *v1beta1.Input, rsp *fnv1.RunFunctionResponse) bool {
 	// Process references based on query type
 	switch in.QueryType {
 	case "GroupMembership":
 		return f.processGroupRef(req, in, rsp)
-	case "GroupObjectIDs":
+	case "GroupObjectIDs", "GroupOwners":
 		return f.processGroupsRef(req, in, rsp)
-	case "UserValidation":
+	case "UserValidation", "UserMemberOf":
 		return f.processUsersRef(req, in, rsp)
-	case "ServicePrincipalDetails":
+	case "ServicePrincipalDetails", "OAuth2PermissionGrants":
 		return f.processServicePrincipalsRef(req, in, rsp)
+	case "ApplicationDetails":
+		return f.processApplicationsRef(req, in, rsp)
+	case "CheckMembership":
+		return f.processPrincipalRef(req, in, rsp) && f.processGroupsRef(req, in, rsp)
+	case "DirectoryRoleAssignments":
+		return f.processPrincipalRef(req, in, rsp) && f.processRoleRef(req, in, rsp)
+	case "AppRoleAssignments":
+		return f.processServicePrincipalsRef(req, in, rsp) && f.processResourceRef(req, in, rsp)
 	}
 	return true
 }
@@ -951,7 +2153,39 @@ func (f *Function) processGroupRef(req *fnv1.RunFunctionRequest, in *v1beta1.Inp
 	return true
 }
 
-// processGroupsRef handles resolving the groupsRef reference for GroupObjectIDs query type
+// processPrincipalRef handles resolving the principalRef reference for CheckMembership and DirectoryRoleAssignments query types
+func (f *Function) processPrincipalRef(req *fnv1.RunFunctionRequest, in *v1beta1.Input, rsp *fnv1.RunFunctionResponse) bool {
+	if in.PrincipalRef == nil || *in.PrincipalRef == "" {
+		return true
+	}
+
+	principal, err := f.resolveStringRef(req, in.PrincipalRef, "principalRef")
+	if err != nil {
+		response.Fatal(rsp, err)
+		return false
+	}
+	in.Principal = &principal
+	f.log.Info("Resolved PrincipalRef to principal", "principal", principal, "principalRef", *in.PrincipalRef)
+	return true
+}
+
+// processRoleRef handles resolving the roleRef reference for DirectoryRoleAssignments query type
+func (f *Function) processRoleRef(req *fnv1.RunFunctionRequest, in *v1beta1.Input, rsp *fnv1.RunFunctionResponse) bool {
+	if in.RoleRef == nil || *in.RoleRef == "" {
+		return true
+	}
+
+	role, err := f.resolveStringRef(req, in.RoleRef, "roleRef")
+	if err != nil {
+		response.Fatal(rsp, err)
+		return false
+	}
+	in.Role = &role
+	f.log.Info("Resolved RoleRef to role", "role", role, "roleRef", *in.RoleRef)
+	return true
+}
+
+// processGroupsRef handles resolving the groupsRef reference for GroupObjectIDs, GroupOwners and CheckMembership query types
 func (f *Function) processGroupsRef(req *fnv1.RunFunctionRequest, in *v1beta1.Input, rsp *fnv1.RunFunctionResponse) bool {
 	if in.GroupsRef == nil || *in.GroupsRef == "" {
 		return true
@@ -967,7 +2201,7 @@ func (f *Function) processGroupsRef(req *fnv1.RunFunctionRequest, in *v1beta1.In
 	return true
 }
 
-// processUsersRef handles resolving the usersRef reference for UserValidation query type
+// processUsersRef handles resolving the usersRef reference for UserValidation and UserMemberOf query types
 func (f *Function) processUsersRef(req *fnv1.RunFunctionRequest, in *v1beta1.Input, rsp *fnv1.RunFunctionResponse) bool {
 	if in.UsersRef == nil || *in.UsersRef == "" {
 		return true
@@ -983,7 +2217,23 @@ func (f *Function) processUsersRef(req *fnv1.RunFunctionRequest, in *v1beta1.Inp
 	return true
 }
 
-// processServicePrincipalsRef handles resolving the servicePrincipalsRef reference for ServicePrincipalDetails query type
+// processResourceRef handles resolving the resourceRef reference for AppRoleAssignments query type
+func (f *Function) processResourceRef(req *fnv1.RunFunctionRequest, in *v1beta1.Input, rsp *fnv1.RunFunctionResponse) bool {
+	if in.ResourceRef == nil || *in.ResourceRef == "" {
+		return true
+	}
+
+	resourceName, err := f.resolveStringRef(req, in.ResourceRef, "resourceRef")
+	if err != nil {
+		response.Fatal(rsp, err)
+		return false
+	}
+	in.Resource = &resourceName
+	f.log.Info("Resolved ResourceRef to resource", "resource", resourceName, "resourceRef", *in.ResourceRef)
+	return true
+}
+
+// processServicePrincipalsRef handles resolving the servicePrincipalsRef reference for ServicePrincipalDetails, AppRoleAssignments and OAuth2PermissionGrants query types
 func (f *Function) processServicePrincipalsRef(req *fnv1.RunFunctionRequest, in *v1beta1.Input, rsp *fnv1.RunFunctionResponse) bool {
 	if in.ServicePrincipalsRef == nil || *in.ServicePrincipalsRef == "" {
 		return true
@@ -999,6 +2249,22 @@ func (f *Function) processServicePrincipalsRef(req *fnv1.RunFunctionRequest, in
 	return true
 }
 
+// processApplicationsRef handles resolving the applicationsRef reference for ApplicationDetails query type
+func (f *Function) processApplicationsRef(req *fnv1.RunFunctionRequest, in *v1beta1.Input, rsp *fnv1.RunFunctionResponse) bool {
+	if in.ApplicationsRef == nil || *in.ApplicationsRef == "" {
+		return true
+	}
+
+	appNames, err := f.resolveApplicationsRef(req, in.ApplicationsRef)
+	if err != nil {
+		response.Fatal(rsp, err)
+		return false
+	}
+	in.Applications = appNames
+	f.log.Info("Resolved ApplicationsRef to applications", "appCount", len(appNames), "applicationsRef", *in.ApplicationsRef)
+	return true
+}
+
 // executeAndProcessQuery executes the query and processes the results
 func (f *Function) executeAndProcessQuery(ctx context.Context, req *fnv1.RunFunctionRequest, in *v1beta1.Input, azureCreds map[string]string, rsp *fnv1.RunFunctionResponse) bool {
 	// Execute the query
@@ -1007,6 +2273,30 @@ func (f *Function) executeAndProcessQuery(ctx context.Context, req *fnv1.RunFunc
 		return false
 	}
 
+	// Check that every requested identity was found
+	if !f.checkMissing(in, results, rsp) {
+		return false
+	}
+
+	// Sort the results, so that they are stored in the same order on every run
+	results = sortResults(in, results)
+
+	// Shape the results as the output format says
+	results, err = formatResults(in, results)
+	if err != nil {
+		response.Fatal(rsp, err)
+		return false
+	}
+
+	// Reshape the results with the transform
+	if in.Transform != nil && *in.Transform != "" {
+		results, err = transformResults(*in.Transform, results)
+		if err != nil {
+			response.Fatal(rsp, err)
+			return false
+		}
+	}
+
 	// Process the results
 	if err := f.processResults(req, in, results, rsp); err != nil {
 		return false
@@ -1060,27 +2350,32 @@ func (f *Function) checkContextTargetHasData(req *fnv1.RunFunctionRequest, in *v
 
 // resolveGroupRef resolves the group name from a reference in spec, status or context.
 func (f *Function) resolveGroupRef(req *fnv1.RunFunctionRequest, groupRef *string) (string, error) {
-	if groupRef == nil || *groupRef == "" {
-		return "", errors.New("empty groupRef provided")
+	return f.resolveStringRef(req, groupRef, "groupRef")
+}
+
+// resolveStringRef resolves a single string value from a reference in spec, status or context.
+func (f *Function) resolveStringRef(req *fnv1.RunFunctionRequest, ref *string, refType string) (string, error) {
+	if ref == nil || *ref == "" {
+		return "", errors.Errorf("empty %s provided", refType)
 	}
 
-	refKey := *groupRef
+	refKey := *ref
 
 	// Use a proper switch statement instead of if-else chain
 	switch {
 	case strings.HasPrefix(refKey, "status."):
-		return f.resolveFromStatus(req, refKey)
+		return f.resolveFromStatus(req, refKey, refType)
 	case strings.HasPrefix(refKey, "context."):
-		return f.resolveFromContext(req, refKey)
+		return f.resolveFromContext(req, refKey, refType)
 	case strings.HasPrefix(refKey, "spec."):
-		return f.resolveFromSpec(req, refKey)
+		return f.resolveFromSpec(req, refKey, refType)
 	default:
-		return "", errors.Errorf("unsupported groupRef format: %s", refKey)
+		return "", errors.Errorf("unsupported %s format: %s", refType, refKey)
 	}
 }
 
 // resolveFromStatus resolves a reference from XR status
-func (f *Function) resolveFromStatus(req *fnv1.RunFunctionRequest, refKey string) (string, error) {
+func (f *Function) resolveFromStatus(req *fnv1.RunFunctionRequest, refKey, refType string) (string, error) {
 	xrStatus, _, err := f.getXRAndStatus(req)
 	if err != nil {
 		return "", errors.Wrap(err, "cannot get XR status")
@@ -1089,24 +2384,24 @@ func (f *Function) resolveFromStatus(req *fnv1.RunFunctionRequest, refKey string
 	statusField := strings.TrimPrefix(refKey, "status.")
 	value, ok := GetNestedKey(xrStatus, statusField)
 	if !ok {
-		return "", errors.Errorf("cannot resolve groupRef: %s not found", refKey)
+		return "", errors.Errorf("cannot resolve %s: %s not found", refType, refKey)
 	}
 	return value, nil
 }
 
 // resolveFromContext resolves a reference from function context
-func (f *Function) resolveFromContext(req *fnv1.RunFunctionRequest, refKey string) (string, error) {
+func (f *Function) resolveFromContext(req *fnv1.RunFunctionRequest, refKey, refType string) (string, error) {
 	contextMap := req.GetContext().AsMap()
 	contextField := strings.TrimPrefix(refKey, "context.")
 	value, ok := GetNestedKey(contextMap, contextField)
 	if !ok {
-		return "", errors.Errorf("cannot resolve groupRef: %s not found", refKey)
+		return "", errors.Errorf("cannot resolve %s: %s not found", refType, refKey)
 	}
 	return value, nil
 }
 
 // resolveFromSpec resolves a reference from XR spec
-func (f *Function) resolveFromSpec(req *fnv1.RunFunctionRequest, refKey string) (string, error) {
+func (f *Function) resolveFromSpec(req *fnv1.RunFunctionRequest, refKey, refType string) (string, error) {
 	// Use getXRAndStatus to ensure spec is copied to desired XR
 	_, dxr, err := f.getXRAndStatus(req)
 	if err != nil {
@@ -1123,7 +2418,7 @@ func (f *Function) resolveFromSpec(req *fnv1.RunFunctionRequest, refKey string)
 	specField := strings.TrimPrefix(refKey, "spec.")
 	value, ok := GetNestedKey(xrSpec, specField)
 	if !ok {
-		return "", errors.Errorf("cannot resolve groupRef: %s not found", refKey)
+		return "", errors.Errorf("cannot resolve %s: %s not found", refType, refKey)
 	}
 	return value, nil
 }
@@ -1215,6 +2510,11 @@ func (f *Function) resolveServicePrincipalsRef(req *fnv1.RunFunctionRequest, ser
 	return f.resolveStringArrayRef(req, servicePrincipalsRef, "servicePrincipalsRef")
 }
 
+// resolveApplicationsRef resolves a list of application names from a reference in status or context
+func (f *Function) resolveApplicationsRef(req *fnv1.RunFunctionRequest, applicationsRef *string) ([]*string, error) {
+	return f.resolveStringArrayRef(req, applicationsRef, "applicationsRef")
+}
+
 // extractStringArrayFromMap extracts a string array from a map using nested key
 func (f *Function) extractStringArrayFromMap(dataMap map[string]interface{}, field, refKey string) ([]*string, error) {
 	parts, err := ParseNestedKey(field)
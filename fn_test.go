@@ -30,6 +30,14 @@ func strPtr(s string) *string {
 	return &s
 }
 
+func intPtr(i int) *int {
+	return &i
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
 // TestResolveGroupsRef tests the functionality of resolving groupsRef from context, status, or spec
 func TestResolveGroupsRef(t *testing.T) {
 	var (
@@ -510,18 +518,18 @@ func TestResolveGroupRef(t *testing.T) {
 										"name": "Developers"
 									},
 									"groupMembers": [
+										{
+											"id": "sp-id-1",
+											"displayName": "Test Service Principal",
+											"appId": "sp-app-id-1",
+											"type": "servicePrincipal"
+										},
 										{
 											"id": "user-id-1",
 											"displayName": "Test User 1",
 											"mail": "user1@example.com",
 											"type": "user",
 											"userPrincipalName": "user1@example.com"
-										},
-										{
-											"id": "sp-id-1",
-											"displayName": "Test Service Principal",
-											"appId": "sp-app-id-1",
-											"type": "servicePrincipal"
 										}
 									]
 								}}`),
@@ -596,18 +604,18 @@ func TestResolveGroupRef(t *testing.T) {
 								},
 								"status": {
 									"groupMembers": [
+										{
+											"id": "sp-id-1",
+											"displayName": "Test Service Principal",
+											"appId": "sp-app-id-1",
+											"type": "servicePrincipal"
+										},
 										{
 											"id": "user-id-1",
 											"displayName": "Test User 1",
 											"mail": "user1@example.com",
 											"type": "user",
 											"userPrincipalName": "user1@example.com"
-										},
-										{
-											"id": "sp-id-1",
-											"displayName": "Test Service Principal",
-											"appId": "sp-app-id-1",
-											"type": "servicePrincipal"
 										}
 									]
 								}}`),
@@ -679,18 +687,18 @@ func TestResolveGroupRef(t *testing.T) {
 								},
 								"status": {
 									"groupMembers": [
+										{
+											"id": "sp-id-1",
+											"displayName": "Test Service Principal",
+											"appId": "sp-app-id-1",
+											"type": "servicePrincipal"
+										},
 										{
 											"id": "user-id-1",
 											"displayName": "Test User 1",
 											"mail": "user1@example.com",
 											"type": "user",
 											"userPrincipalName": "user1@example.com"
-										},
-										{
-											"id": "sp-id-1",
-											"displayName": "Test Service Principal",
-											"appId": "sp-app-id-1",
-											"type": "servicePrincipal"
 										}
 									]
 								}}`),
@@ -886,6 +894,12 @@ func TestResolveUsersRef(t *testing.T) {
 								"status": {
 									"users": ["user1@example.com", "user2@example.com", "admin@example.onmicrosoft.com"],
 									"validatedUsers": [
+										{
+											"id": "admin-id",
+											"displayName": "Admin User",
+											"userPrincipalName": "admin@example.onmicrosoft.com",
+											"mail": "admin@example.onmicrosoft.com"
+										},
 										{
 											"id": "user-id-1",
 											"displayName": "User 1",
@@ -897,12 +911,6 @@ func TestResolveUsersRef(t *testing.T) {
 											"displayName": "User 2",
 											"userPrincipalName": "user2@example.com",
 											"mail": "user2@example.com"
-										},
-										{
-											"id": "admin-id",
-											"displayName": "Admin User",
-											"userPrincipalName": "admin@example.onmicrosoft.com",
-											"mail": "admin@example.onmicrosoft.com"
 										}
 									]
 								}}`),
@@ -973,6 +981,12 @@ func TestResolveUsersRef(t *testing.T) {
 								},
 								"status": {
 									"validatedUsers": [
+										{
+											"id": "admin-id",
+											"displayName": "Admin User",
+											"userPrincipalName": "admin@example.onmicrosoft.com",
+											"mail": "admin@example.onmicrosoft.com"
+										},
 										{
 											"id": "user-id-1",
 											"displayName": "User 1",
@@ -984,12 +998,6 @@ func TestResolveUsersRef(t *testing.T) {
 											"displayName": "User 2",
 											"userPrincipalName": "user2@example.com",
 											"mail": "user2@example.com"
-										},
-										{
-											"id": "admin-id",
-											"displayName": "Admin User",
-											"userPrincipalName": "admin@example.onmicrosoft.com",
-											"mail": "admin@example.onmicrosoft.com"
 										}
 									]
 								}}`),
@@ -1061,6 +1069,12 @@ func TestResolveUsersRef(t *testing.T) {
 								},
 								"status": {
 									"validatedUsers": [
+										{
+											"id": "admin-id",
+											"displayName": "Admin User",
+											"userPrincipalName": "admin@example.onmicrosoft.com",
+											"mail": "admin@example.onmicrosoft.com"
+										},
 										{
 											"id": "user-id-1",
 											"displayName": "User 1",
@@ -1072,12 +1086,6 @@ func TestResolveUsersRef(t *testing.T) {
 											"displayName": "User 2",
 											"userPrincipalName": "user2@example.com",
 											"mail": "user2@example.com"
-										},
-										{
-											"id": "admin-id",
-											"displayName": "Admin User",
-											"userPrincipalName": "admin@example.onmicrosoft.com",
-											"mail": "admin@example.onmicrosoft.com"
 										}
 									]
 								}}`),
@@ -1622,14 +1630,14 @@ func TestResolveServicePrincipalsRef(t *testing.T) {
 	}
 }
 
-func TestRunFunction(t *testing.T) {
-
+// TestResolveApplicationsRef tests the functionality of resolving applicationsRef from context, status, or spec
+func TestResolveApplicationsRef(t *testing.T) {
 	var (
 		xr    = `{"apiVersion":"example.org/v1","kind":"XR","metadata":{"name":"cool-xr"},"spec":{"count":2}}`
 		creds = &fnv1.CredentialData{
 			Data: map[string][]byte{
 				"credentials": []byte(`{
-"clientId": "test-cliend-id",
+"clientId": "test-client-id",
 "clientSecret": "test-client-secret",
 "subscriptionId": "test-subscription-id",
 "tenantId": "test-tenant-id"
@@ -1652,51 +1660,30 @@ func TestRunFunction(t *testing.T) {
 		args   args
 		want   want
 	}{
-		"ResponseIsReturned": {
-			reason: "The Function should return a fatal result if no credentials were specified",
+		"ApplicationsRefFromStatus": {
+			reason: "The Function should resolve applicationsRef from XR status",
 			args: args{
+				ctx: context.Background(),
 				req: &fnv1.RunFunctionRequest{
 					Meta: &fnv1.RequestMeta{Tag: "hello"},
 					Input: resource.MustStructJSON(`{
 						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
 						"kind": "Input",
-						"queryType": "UserValidation",
-						"users": ["user@example.com"]
+						"queryType": "ApplicationDetails",
+						"applicationsRef": "status.applicationNames",
+						"target": "status.applications"
 					}`),
-				},
-			},
-			want: want{
-				rsp: &fnv1.RunFunctionResponse{
-					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
-					Results: []*fnv1.Result{
-						{
-							Severity: fnv1.Severity_SEVERITY_FATAL,
-							Message:  "failed to get azure-creds credentials",
-							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
-						},
-					},
-					Desired: &fnv1.State{
+					Observed: &fnv1.State{
 						Composite: &fnv1.Resource{
 							Resource: resource.MustStructJSON(`{
-								"apiVersion": "",
-								"kind": ""
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"status": {
+									"applicationNames": ["MyApp", "ApiClient", "web-portal"]
+								}
 							}`),
 						},
 					},
-				},
-			},
-		},
-		"MissingUserValidationTarget": {
-			reason: "The Function should return a fatal result if no target is specified",
-			args: args{
-				req: &fnv1.RunFunctionRequest{
-					Meta: &fnv1.RequestMeta{Tag: "hello"},
-					Input: resource.MustStructJSON(`{
-						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
-						"kind": "Input",
-						"queryType": "UserValidation",
-						"users": ["user@example.com"]
-					}`),
 					Credentials: map[string]*fnv1.Credentials{
 						"azure-creds": {
 							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
@@ -1707,26 +1694,56 @@ func TestRunFunction(t *testing.T) {
 			want: want{
 				rsp: &fnv1.RunFunctionResponse{
 					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:   "FunctionSuccess",
+							Status: fnv1.Status_STATUS_CONDITION_TRUE,
+							Reason: "Success",
+							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
 					Results: []*fnv1.Result{
 						{
-							Severity: fnv1.Severity_SEVERITY_FATAL,
-							Message:  "Unrecognized target field: ",
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `QueryType: "ApplicationDetails"`,
 							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
 						},
 					},
 					Desired: &fnv1.State{
 						Composite: &fnv1.Resource{
 							Resource: resource.MustStructJSON(`{
-								"apiVersion": "",
-								"kind": ""
-							}`),
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"status": {
+									"applicationNames": ["MyApp", "ApiClient", "web-portal"],
+									"applications": [
+										{
+											"id": "app-object-id-1",
+											"appId": "app-id-1",
+											"displayName": "MyApp",
+											"description": "Application"
+										},
+										{
+											"id": "app-object-id-2",
+											"appId": "app-id-2",
+											"displayName": "ApiClient",
+											"description": "API client application"
+										},
+										{
+											"id": "app-object-id-3",
+											"appId": "app-id-3",
+											"displayName": "web-portal",
+											"description": "Web portal application"
+										}
+									]
+								}}`),
 						},
 					},
 				},
 			},
 		},
-		"UserValidationMissingUsers": {
-			reason: "The Function should handle UserValidation with missing users",
+		"ApplicationsRefFromContext": {
+			reason: "The Function should resolve applicationsRef from context",
 			args: args{
 				ctx: context.Background(),
 				req: &fnv1.RunFunctionRequest{
@@ -1734,8 +1751,12 @@ func TestRunFunction(t *testing.T) {
 					Input: resource.MustStructJSON(`{
 						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
 						"kind": "Input",
-						"queryType": "UserValidation",
-						"target": "status.validatedUsers"
+						"queryType": "ApplicationDetails",
+						"applicationsRef": "context.applicationNames",
+						"target": "status.applications"
+					}`),
+					Context: resource.MustStructJSON(`{
+						"applicationNames": ["MyApp", "ApiClient", "web-portal"]
 					}`),
 					Observed: &fnv1.State{
 						Composite: &fnv1.Resource{
@@ -1752,13 +1773,24 @@ func TestRunFunction(t *testing.T) {
 			want: want{
 				rsp: &fnv1.RunFunctionResponse{
 					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:   "FunctionSuccess",
+							Status: fnv1.Status_STATUS_CONDITION_TRUE,
+							Reason: "Success",
+							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
 					Results: []*fnv1.Result{
 						{
-							Severity: fnv1.Severity_SEVERITY_FATAL,
-							Message:  "no users provided for validation",
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `QueryType: "ApplicationDetails"`,
 							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
 						},
 					},
+					Context: resource.MustStructJSON(`{
+						"applicationNames": ["MyApp", "ApiClient", "web-portal"]
+					}`),
 					Desired: &fnv1.State{
 						Composite: &fnv1.Resource{
 							Resource: resource.MustStructJSON(`{
@@ -1769,15 +1801,36 @@ func TestRunFunction(t *testing.T) {
 								},
 								"spec": {
 									"count": 2
-								}
-							}`),
+								},
+								"status": {
+									"applications": [
+										{
+											"id": "app-object-id-1",
+											"appId": "app-id-1",
+											"displayName": "MyApp",
+											"description": "Application"
+										},
+										{
+											"id": "app-object-id-2",
+											"appId": "app-id-2",
+											"displayName": "ApiClient",
+											"description": "API client application"
+										},
+										{
+											"id": "app-object-id-3",
+											"appId": "app-id-3",
+											"displayName": "web-portal",
+											"description": "Web portal application"
+										}
+									]
+								}}`),
 						},
 					},
 				},
 			},
 		},
-		"SuccessfulUserValidation": {
-			reason: "The Function should handle a successful UserValidation query",
+		"ApplicationsRefFromSpec": {
+			reason: "The Function should resolve applicationsRef from XR spec",
 			args: args{
 				ctx: context.Background(),
 				req: &fnv1.RunFunctionRequest{
@@ -1785,13 +1838,21 @@ func TestRunFunction(t *testing.T) {
 					Input: resource.MustStructJSON(`{
 						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
 						"kind": "Input",
-						"queryType": "UserValidation",
-						"users": ["user@example.com"],
-						"target": "status.validatedUsers"
+						"queryType": "ApplicationDetails",
+						"applicationsRef": "spec.applicationConfig.names",
+						"target": "status.applications"
 					}`),
 					Observed: &fnv1.State{
 						Composite: &fnv1.Resource{
-							Resource: resource.MustStructJSON(xr),
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"spec": {
+									"applicationConfig": {
+										"names": ["MyApp", "ApiClient", "web-portal"]
+									}
+								}
+							}`),
 						},
 					},
 					Credentials: map[string]*fnv1.Credentials{
@@ -1815,7 +1876,7 @@ func TestRunFunction(t *testing.T) {
 					Results: []*fnv1.Result{
 						{
 							Severity: fnv1.Severity_SEVERITY_NORMAL,
-							Message:  `QueryType: "UserValidation"`,
+							Message:  `QueryType: "ApplicationDetails"`,
 							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
 						},
 					},
@@ -1824,19 +1885,30 @@ func TestRunFunction(t *testing.T) {
 							Resource: resource.MustStructJSON(`{
 								"apiVersion": "example.org/v1",
 								"kind": "XR",
-								"metadata": {
-									"name": "cool-xr"
-								},
 								"spec": {
-									"count": 2
+									"applicationConfig": {
+										"names": ["MyApp", "ApiClient", "web-portal"]
+									}
 								},
 								"status": {
-									"validatedUsers": [
+									"applications": [
 										{
-											"id": "test-user-id",
-											"displayName": "Test User",
-											"userPrincipalName": "user@example.com",
-											"mail": "user@example.com"
+											"id": "app-object-id-1",
+											"appId": "app-id-1",
+											"displayName": "MyApp",
+											"description": "Application"
+										},
+										{
+											"id": "app-object-id-2",
+											"appId": "app-id-2",
+											"displayName": "ApiClient",
+											"description": "API client application"
+										},
+										{
+											"id": "app-object-id-3",
+											"appId": "app-id-3",
+											"displayName": "web-portal",
+											"description": "Web portal application"
 										}
 									]
 								}}`),
@@ -1845,8 +1917,8 @@ func TestRunFunction(t *testing.T) {
 				},
 			},
 		},
-		"GroupMembershipMissingGroup": {
-			reason: "The Function should handle GroupMembership with missing group",
+		"ApplicationsRefNotFound": {
+			reason: "The Function should handle an error when applicationsRef cannot be resolved",
 			args: args{
 				ctx: context.Background(),
 				req: &fnv1.RunFunctionRequest{
@@ -1854,8 +1926,9 @@ func TestRunFunction(t *testing.T) {
 					Input: resource.MustStructJSON(`{
 						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
 						"kind": "Input",
-						"queryType": "GroupMembership",
-						"target": "status.groupMembers"
+						"queryType": "ApplicationDetails",
+						"applicationsRef": "context.nonexistent.value",
+						"target": "status.applications"
 					}`),
 					Observed: &fnv1.State{
 						Composite: &fnv1.Resource{
@@ -1875,7 +1948,7 @@ func TestRunFunction(t *testing.T) {
 					Results: []*fnv1.Result{
 						{
 							Severity: fnv1.Severity_SEVERITY_FATAL,
-							Message:  "no group name provided",
+							Message:  "cannot resolve applicationsRef: context.nonexistent.value not found",
 							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
 						},
 					},
@@ -1896,84 +1969,113 @@ func TestRunFunction(t *testing.T) {
 				},
 			},
 		},
-		"SuccessfulGroupMembership": {
-			reason: "The Function should handle a successful GroupMembership query",
-			args: args{
-				ctx: context.Background(),
-				req: &fnv1.RunFunctionRequest{
-					Meta: &fnv1.RequestMeta{Tag: "hello"},
-					Input: resource.MustStructJSON(`{
-						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
-						"kind": "Input",
-						"queryType": "GroupMembership",
-						"group": "Developers",
-						"target": "status.groupMembers"
-					}`),
-					Observed: &fnv1.State{
-						Composite: &fnv1.Resource{
-							Resource: resource.MustStructJSON(xr),
-						},
-					},
-					Credentials: map[string]*fnv1.Credentials{
-						"azure-creds": {
-							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
-						},
-					},
-				},
-			},
-			want: want{
-				rsp: &fnv1.RunFunctionResponse{
-					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
-					Conditions: []*fnv1.Condition{
-						{
-							Type:   "FunctionSuccess",
-							Status: fnv1.Status_STATUS_CONDITION_TRUE,
-							Reason: "Success",
-							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
-						},
-					},
-					Results: []*fnv1.Result{
-						{
-							Severity: fnv1.Severity_SEVERITY_NORMAL,
-							Message:  `QueryType: "GroupMembership"`,
-							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
-						},
-					},
-					Desired: &fnv1.State{
-						Composite: &fnv1.Resource{
-							Resource: resource.MustStructJSON(`{
-								"apiVersion": "example.org/v1",
-								"kind": "XR",
-								"metadata": {
-									"name": "cool-xr"
-								},
-								"spec": {
-									"count": 2
-								},
-								"status": {
-									"groupMembers": [
-										{
-											"id": "user-id-1",
-											"displayName": "Test User 1",
-											"mail": "user1@example.com",
-											"type": "user",
-											"userPrincipalName": "user1@example.com"
-										},
-										{
-											"id": "sp-id-1",
-											"displayName": "Test Service Principal",
-											"appId": "sp-app-id-1",
-											"type": "servicePrincipal"
-										}
-									]
-								}}`),
-						},
-					},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			// Create mock responders for each type of query
+			mockQuery := &MockGraphQuery{
+				GraphQueryFunc: func(_ context.Context, _ map[string]string, in *v1beta1.Input) (interface{}, error) {
+					if in.QueryType == "ApplicationDetails" {
+						if len(in.Applications) == 0 {
+							return nil, errors.New("no application names provided")
+						}
+
+						var results []interface{}
+						for i, app := range in.Applications {
+							if app == nil {
+								continue
+							}
+
+							var (
+								objectID    string
+								appID       string
+								description string
+							)
+
+							// Generate different test data based on application name
+							switch *app {
+							case "MyApp":
+								objectID = "app-object-id-1"
+								appID = "app-id-1"
+								description = "Application"
+							case "ApiClient":
+								objectID = "app-object-id-2"
+								appID = "app-id-2"
+								description = "API client application"
+							case "web-portal":
+								objectID = "app-object-id-3"
+								appID = "app-id-3"
+								description = "Web portal application"
+							default:
+								objectID = fmt.Sprintf("app-object-id-%d", i+1)
+								appID = fmt.Sprintf("app-id-%d", i+1)
+								description = "Generic application"
+							}
+
+							appMap := map[string]interface{}{
+								"id":          objectID,
+								"appId":       appID,
+								"displayName": *app,
+								"description": description,
+							}
+							results = append(results, appMap)
+						}
+						return results, nil
+					}
+					return nil, errors.Errorf("unsupported query type: %s", in.QueryType)
 				},
+			}
+
+			f := &Function{
+				graphQuery: mockQuery,
+				log:        logging.NewNopLogger(),
+			}
+			rsp, err := f.RunFunction(tc.args.ctx, tc.args.req)
+
+			if diff := cmp.Diff(tc.want.rsp, rsp, protocmp.Transform()); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want rsp, +got rsp:\n%s", tc.reason, diff)
+			}
+
+			if diff := cmp.Diff(tc.want.err, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+// TestResolvePrincipalRef tests the functionality of resolving principalRef from context, status, or spec
+func TestResolvePrincipalRef(t *testing.T) {
+	var (
+		xr    = `{"apiVersion":"example.org/v1","kind":"XR","metadata":{"name":"cool-xr"},"spec":{"count":2}}`
+		creds = &fnv1.CredentialData{
+			Data: map[string][]byte{
+				"credentials": []byte(`{
+"clientId": "test-client-id",
+"clientSecret": "test-client-secret",
+"subscriptionId": "test-subscription-id",
+"tenantId": "test-tenant-id"
+}`),
 			},
-		},
-		"GroupObjectIDsMissingGroups": {
-			reason: "The Function should handle GroupObjectIDs with missing groups",
+		}
+	)
+
+	type args struct {
+		ctx context.Context
+		req *fnv1.RunFunctionRequest
+	}
+	type want struct {
+		rsp *fnv1.RunFunctionResponse
+		err error
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"PrincipalRefFromStatus": {
+			reason: "The Function should resolve principalRef from XR status",
 			args: args{
 				ctx: context.Background(),
 				req: &fnv1.RunFunctionRequest{
@@ -1981,12 +2083,22 @@ func TestRunFunction(t *testing.T) {
 					Input: resource.MustStructJSON(`{
 						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
 						"kind": "Input",
-						"queryType": "GroupObjectIDs",
-						"target": "status.groupObjectIDs"
+						"queryType": "CheckMembership",
+						"groups": ["Developers"],
+						"principalRef": "status.principalInfo.name",
+						"target": "status.membership"
 					}`),
 					Observed: &fnv1.State{
 						Composite: &fnv1.Resource{
-							Resource: resource.MustStructJSON(xr),
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"status": {
+									"principalInfo": {
+										"name": "user@example.com"
+									}
+								}
+							}`),
 						},
 					},
 					Credentials: map[string]*fnv1.Credentials{
@@ -1999,10 +2111,18 @@ func TestRunFunction(t *testing.T) {
 			want: want{
 				rsp: &fnv1.RunFunctionResponse{
 					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:   "FunctionSuccess",
+							Status: fnv1.Status_STATUS_CONDITION_TRUE,
+							Reason: "Success",
+							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
 					Results: []*fnv1.Result{
 						{
-							Severity: fnv1.Severity_SEVERITY_FATAL,
-							Message:  "no group names provided",
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `QueryType: "CheckMembership"`,
 							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
 						},
 					},
@@ -2011,11 +2131,13 @@ func TestRunFunction(t *testing.T) {
 							Resource: resource.MustStructJSON(`{
 								"apiVersion": "example.org/v1",
 								"kind": "XR",
-								"metadata": {
-									"name": "cool-xr"
-								},
-								"spec": {
-									"count": 2
+								"status": {
+									"principalInfo": {
+										"name": "user@example.com"
+									},
+									"membership": {
+										"Developers": true
+									}
 								}
 							}`),
 						},
@@ -2023,8 +2145,8 @@ func TestRunFunction(t *testing.T) {
 				},
 			},
 		},
-		"SuccessfulGroupObjectIDs": {
-			reason: "The Function should handle a successful GroupObjectIDs query",
+		"PrincipalRefFromContext": {
+			reason: "The Function should resolve principalRef from context",
 			args: args{
 				ctx: context.Background(),
 				req: &fnv1.RunFunctionRequest{
@@ -2032,9 +2154,15 @@ func TestRunFunction(t *testing.T) {
 					Input: resource.MustStructJSON(`{
 						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
 						"kind": "Input",
-						"queryType": "GroupObjectIDs",
-						"groups": ["Developers", "Operations"],
-						"target": "status.groupObjectIDs"
+						"queryType": "CheckMembership",
+						"groups": ["Developers"],
+						"principalRef": "context.principalInfo.name",
+						"target": "status.membership"
+					}`),
+					Context: resource.MustStructJSON(`{
+						"principalInfo": {
+							"name": "user@example.com"
+						}
 					}`),
 					Observed: &fnv1.State{
 						Composite: &fnv1.Resource{
@@ -2062,10 +2190,15 @@ func TestRunFunction(t *testing.T) {
 					Results: []*fnv1.Result{
 						{
 							Severity: fnv1.Severity_SEVERITY_NORMAL,
-							Message:  `QueryType: "GroupObjectIDs"`,
+							Message:  `QueryType: "CheckMembership"`,
 							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
 						},
 					},
+					Context: resource.MustStructJSON(`{
+						"principalInfo": {
+							"name": "user@example.com"
+						}
+					}`),
 					Desired: &fnv1.State{
 						Composite: &fnv1.Resource{
 							Resource: resource.MustStructJSON(`{
@@ -2078,26 +2211,18 @@ func TestRunFunction(t *testing.T) {
 									"count": 2
 								},
 								"status": {
-									"groupObjectIDs": [
-										{
-											"id": "group-id-1",
-											"displayName": "Developers",
-											"description": "Development team"
-										},
-										{
-											"id": "group-id-2",
-											"displayName": "Operations",
-											"description": "Operations team"
-										}
-									]
-								}}`),
+									"membership": {
+										"Developers": true
+									}
+								}
+							}`),
 						},
 					},
 				},
 			},
 		},
-		"ServicePrincipalDetailsMissingNames": {
-			reason: "The Function should handle ServicePrincipalDetails with missing names",
+		"PrincipalRefFromSpec": {
+			reason: "The Function should resolve principalRef from XR spec",
 			args: args{
 				ctx: context.Background(),
 				req: &fnv1.RunFunctionRequest{
@@ -2105,66 +2230,24 @@ func TestRunFunction(t *testing.T) {
 					Input: resource.MustStructJSON(`{
 						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
 						"kind": "Input",
-						"queryType": "ServicePrincipalDetails",
-						"target": "status.servicePrincipals"
+						"queryType": "CheckMembership",
+						"groups": ["Developers"],
+						"principalRef": "spec.principalConfig.name",
+						"target": "status.membership"
 					}`),
 					Observed: &fnv1.State{
-						Composite: &fnv1.Resource{
-							Resource: resource.MustStructJSON(xr),
-						},
-					},
-					Credentials: map[string]*fnv1.Credentials{
-						"azure-creds": {
-							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
-						},
-					},
-				},
-			},
-			want: want{
-				rsp: &fnv1.RunFunctionResponse{
-					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
-					Results: []*fnv1.Result{
-						{
-							Severity: fnv1.Severity_SEVERITY_FATAL,
-							Message:  "no service principal names provided",
-							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
-						},
-					},
-					Desired: &fnv1.State{
 						Composite: &fnv1.Resource{
 							Resource: resource.MustStructJSON(`{
 								"apiVersion": "example.org/v1",
 								"kind": "XR",
-								"metadata": {
-									"name": "cool-xr"
-								},
 								"spec": {
-									"count": 2
+									"principalConfig": {
+										"name": "user@example.com"
+									}
 								}
 							}`),
 						},
 					},
-				},
-			},
-		},
-		"SuccessfulServicePrincipalDetails": {
-			reason: "The Function should handle a successful ServicePrincipalDetails query",
-			args: args{
-				ctx: context.Background(),
-				req: &fnv1.RunFunctionRequest{
-					Meta: &fnv1.RequestMeta{Tag: "hello"},
-					Input: resource.MustStructJSON(`{
-						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
-						"kind": "Input",
-						"queryType": "ServicePrincipalDetails",
-						"servicePrincipals": ["MyServiceApp"],
-						"target": "status.servicePrincipals"
-					}`),
-					Observed: &fnv1.State{
-						Composite: &fnv1.Resource{
-							Resource: resource.MustStructJSON(xr),
-						},
-					},
 					Credentials: map[string]*fnv1.Credentials{
 						"azure-creds": {
 							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
@@ -2186,7 +2269,7 @@ func TestRunFunction(t *testing.T) {
 					Results: []*fnv1.Result{
 						{
 							Severity: fnv1.Severity_SEVERITY_NORMAL,
-							Message:  `QueryType: "ServicePrincipalDetails"`,
+							Message:  `QueryType: "CheckMembership"`,
 							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
 						},
 					},
@@ -2195,29 +2278,24 @@ func TestRunFunction(t *testing.T) {
 							Resource: resource.MustStructJSON(`{
 								"apiVersion": "example.org/v1",
 								"kind": "XR",
-								"metadata": {
-									"name": "cool-xr"
-								},
 								"spec": {
-									"count": 2
+									"principalConfig": {
+										"name": "user@example.com"
+									}
 								},
 								"status": {
-									"servicePrincipals": [
-										{
-											"id": "sp-id-1",
-											"appId": "app-id-1",
-											"displayName": "MyServiceApp",
-											"description": "Service application"
-										}
-									]
-								}}`),
+									"membership": {
+										"Developers": true
+									}
+								}
+							}`),
 						},
 					},
 				},
 			},
 		},
-		"InvalidQueryType": {
-			reason: "The Function should handle an invalid query type",
+		"PrincipalRefNotFound": {
+			reason: "The Function should handle an error when principalRef cannot be resolved",
 			args: args{
 				ctx: context.Background(),
 				req: &fnv1.RunFunctionRequest{
@@ -2225,8 +2303,10 @@ func TestRunFunction(t *testing.T) {
 					Input: resource.MustStructJSON(`{
 						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
 						"kind": "Input",
-						"queryType": "InvalidType",
-						"target": "status.invalidResult"
+						"queryType": "CheckMembership",
+						"groups": ["Developers"],
+						"principalRef": "context.nonexistent.value",
+						"target": "status.membership"
 					}`),
 					Observed: &fnv1.State{
 						Composite: &fnv1.Resource{
@@ -2246,7 +2326,7 @@ func TestRunFunction(t *testing.T) {
 					Results: []*fnv1.Result{
 						{
 							Severity: fnv1.Severity_SEVERITY_FATAL,
-							Message:  "unsupported query type: InvalidType",
+							Message:  "cannot resolve principalRef: context.nonexistent.value not found",
 							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
 						},
 					},
@@ -2267,19 +2347,84 @@ func TestRunFunction(t *testing.T) {
 				},
 			},
 		},
-		"ShouldSkipQueryWhenStatusTargetHasData": {
-			reason: "The Function should skip query when status target already has data",
-			args: args{
-				ctx: context.Background(),
-				req: &fnv1.RunFunctionRequest{
-					Meta: &fnv1.RequestMeta{Tag: "hello"},
-					Input: resource.MustStructJSON(`{
-						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
-						"kind": "Input",
-						"queryType": "UserValidation",
-						"users": ["user@example.com"],
-						"target": "status.validatedUsers",
-						"skipQueryWhenTargetHasData": true
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			// Create mock responders for each type of query
+			mockQuery := &MockGraphQuery{
+				GraphQueryFunc: func(_ context.Context, _ map[string]string, in *v1beta1.Input) (interface{}, error) {
+					if in.QueryType == "CheckMembership" {
+						if in.Principal == nil || *in.Principal != "user@example.com" {
+							return nil, errors.New("principal was not resolved")
+						}
+						return map[string]interface{}{
+							"Developers": true,
+						}, nil
+					}
+					return nil, errors.Errorf("unsupported query type: %s", in.QueryType)
+				},
+			}
+
+			f := &Function{
+				graphQuery: mockQuery,
+				log:        logging.NewNopLogger(),
+			}
+			rsp, err := f.RunFunction(tc.args.ctx, tc.args.req)
+
+			if diff := cmp.Diff(tc.want.rsp, rsp, protocmp.Transform()); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want rsp, +got rsp:\n%s", tc.reason, diff)
+			}
+
+			if diff := cmp.Diff(tc.want.err, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+// TestResolveRoleRef tests the functionality of resolving roleRef from context, status, or spec
+func TestResolveRoleRef(t *testing.T) {
+	var (
+		xr    = `{"apiVersion":"example.org/v1","kind":"XR","metadata":{"name":"cool-xr"},"spec":{"count":2}}`
+		creds = &fnv1.CredentialData{
+			Data: map[string][]byte{
+				"credentials": []byte(`{
+"clientId": "test-client-id",
+"clientSecret": "test-client-secret",
+"subscriptionId": "test-subscription-id",
+"tenantId": "test-tenant-id"
+}`),
+			},
+		}
+	)
+
+	type args struct {
+		ctx context.Context
+		req *fnv1.RunFunctionRequest
+	}
+	type want struct {
+		rsp *fnv1.RunFunctionResponse
+		err error
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"RoleRefFromStatus": {
+			reason: "The Function should resolve roleRef from XR status",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "DirectoryRoleAssignments",
+						"roleRef": "status.roleInfo.name",
+						"target": "status.roleHolders"
 					}`),
 					Observed: &fnv1.State{
 						Composite: &fnv1.Resource{
@@ -2287,18 +2432,84 @@ func TestRunFunction(t *testing.T) {
 								"apiVersion": "example.org/v1",
 								"kind": "XR",
 								"status": {
-									"validatedUsers": [
+									"roleInfo": {
+										"name": "Global Reader"
+									}
+								}
+							}`),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:   "FunctionSuccess",
+							Status: fnv1.Status_STATUS_CONDITION_TRUE,
+							Reason: "Success",
+							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `QueryType: "DirectoryRoleAssignments"`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"status": {
+									"roleInfo": {
+										"name": "Global Reader"
+									},
+									"roleHolders": [
 										{
-											"id": "existing-user-id",
-											"displayName": "Existing User",
-											"userPrincipalName": "existing@example.com",
-											"mail": "existing@example.com"
+											"id": "assignment-1",
+											"principalId": "user-id-1",
+											"roleName": "Global Reader"
 										}
 									]
 								}
 							}`),
 						},
 					},
+				},
+			},
+		},
+		"RoleRefFromContext": {
+			reason: "The Function should resolve roleRef from context",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "DirectoryRoleAssignments",
+						"roleRef": "context.roleInfo.name",
+						"target": "status.roleHolders"
+					}`),
+					Context: resource.MustStructJSON(`{
+						"roleInfo": {
+							"name": "Global Reader"
+						}
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
 					Credentials: map[string]*fnv1.Credentials{
 						"azure-creds": {
 							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
@@ -2310,13 +2521,6 @@ func TestRunFunction(t *testing.T) {
 				rsp: &fnv1.RunFunctionResponse{
 					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
 					Conditions: []*fnv1.Condition{
-						{
-							Type:    "FunctionSkip",
-							Message: strPtr("Target already has data, skipped query to avoid throttling"),
-							Status:  fnv1.Status_STATUS_CONDITION_TRUE,
-							Reason:  "SkippedQuery",
-							Target:  fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
-						},
 						{
 							Type:   "FunctionSuccess",
 							Status: fnv1.Status_STATUS_CONDITION_TRUE,
@@ -2324,28 +2528,46 @@ func TestRunFunction(t *testing.T) {
 							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
 						},
 					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `QueryType: "DirectoryRoleAssignments"`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Context: resource.MustStructJSON(`{
+						"roleInfo": {
+							"name": "Global Reader"
+						}
+					}`),
 					Desired: &fnv1.State{
 						Composite: &fnv1.Resource{
 							Resource: resource.MustStructJSON(`{
 								"apiVersion": "example.org/v1",
 								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								},
 								"status": {
-									"validatedUsers": [
+									"roleHolders": [
 										{
-											"id": "existing-user-id",
-											"displayName": "Existing User",
-											"userPrincipalName": "existing@example.com",
-											"mail": "existing@example.com"
+											"id": "assignment-1",
+											"principalId": "user-id-1",
+											"roleName": "Global Reader"
 										}
 									]
-								}}`),
+								}
+							}`),
 						},
 					},
 				},
 			},
 		},
-		"QueryToContextField": {
-			reason: "The Function should store results in context field",
+		"RoleRefFromSpec": {
+			reason: "The Function should resolve roleRef from XR spec",
 			args: args{
 				ctx: context.Background(),
 				req: &fnv1.RunFunctionRequest{
@@ -2353,13 +2575,21 @@ func TestRunFunction(t *testing.T) {
 					Input: resource.MustStructJSON(`{
 						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
 						"kind": "Input",
-						"queryType": "UserValidation",
-						"users": ["user@example.com"],
-						"target": "context.validatedUsers"
+						"queryType": "DirectoryRoleAssignments",
+						"roleRef": "spec.roleConfig.name",
+						"target": "status.roleHolders"
 					}`),
 					Observed: &fnv1.State{
 						Composite: &fnv1.Resource{
-							Resource: resource.MustStructJSON(xr),
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"spec": {
+									"roleConfig": {
+										"name": "Global Reader"
+									}
+								}
+							}`),
 						},
 					},
 					Credentials: map[string]*fnv1.Credentials{
@@ -2383,22 +2613,70 @@ func TestRunFunction(t *testing.T) {
 					Results: []*fnv1.Result{
 						{
 							Severity: fnv1.Severity_SEVERITY_NORMAL,
-							Message:  `QueryType: "UserValidation"`,
+							Message:  `QueryType: "DirectoryRoleAssignments"`,
 							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
 						},
 					},
-					Context: resource.MustStructJSON(
-						`{
-							"validatedUsers": [
-								{
-									"id": "test-user-id",
-									"displayName": "Test User",
-									"userPrincipalName": "user@example.com",
-									"mail": "user@example.com"
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"spec": {
+									"roleConfig": {
+										"name": "Global Reader"
+									}
+								},
+								"status": {
+									"roleHolders": [
+										{
+											"id": "assignment-1",
+											"principalId": "user-id-1",
+											"roleName": "Global Reader"
+										}
+									]
 								}
-							]
-						}`,
-					),
+							}`),
+						},
+					},
+				},
+			},
+		},
+		"RoleRefNotFound": {
+			reason: "The Function should handle an error when roleRef cannot be resolved",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "DirectoryRoleAssignments",
+						"roleRef": "context.nonexistent.value",
+						"target": "status.roleHolders"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Message:  "cannot resolve roleRef: context.nonexistent.value not found",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
 					Desired: &fnv1.State{
 						Composite: &fnv1.Resource{
 							Resource: resource.MustStructJSON(`{
@@ -2423,69 +2701,19 @@ func TestRunFunction(t *testing.T) {
 			// Create mock responders for each type of query
 			mockQuery := &MockGraphQuery{
 				GraphQueryFunc: func(_ context.Context, _ map[string]string, in *v1beta1.Input) (interface{}, error) {
-					switch in.QueryType {
-					case "UserValidation":
-						if len(in.Users) == 0 {
-							return nil, errors.New("no users provided for validation")
+					if in.QueryType == "DirectoryRoleAssignments" {
+						if in.Role == nil || *in.Role != "Global Reader" {
+							return nil, errors.New("role was not resolved")
 						}
 						return []interface{}{
 							map[string]interface{}{
-								"id":                "test-user-id",
-								"displayName":       "Test User",
-								"userPrincipalName": "user@example.com",
-								"mail":              "user@example.com",
+								"id":          "assignment-1",
+								"principalId": "user-id-1",
+								"roleName":    *in.Role,
 							},
 						}, nil
-					case "GroupMembership":
-						if in.Group == nil || *in.Group == "" {
-							return nil, errors.New("no group name provided")
-						}
-						return []interface{}{
-							map[string]interface{}{
-								"id":                "user-id-1",
-								"displayName":       "Test User 1",
-								"mail":              "user1@example.com",
-								"userPrincipalName": "user1@example.com",
-								"type":              "user",
-							},
-							map[string]interface{}{
-								"id":          "sp-id-1",
-								"displayName": "Test Service Principal",
-								"appId":       "sp-app-id-1",
-								"type":        "servicePrincipal",
-							},
-						}, nil
-					case "GroupObjectIDs":
-						if len(in.Groups) == 0 {
-							return nil, errors.New("no group names provided")
-						}
-						return []interface{}{
-							map[string]interface{}{
-								"id":          "group-id-1",
-								"displayName": "Developers",
-								"description": "Development team",
-							},
-							map[string]interface{}{
-								"id":          "group-id-2",
-								"displayName": "Operations",
-								"description": "Operations team",
-							},
-						}, nil
-					case "ServicePrincipalDetails":
-						if len(in.ServicePrincipals) == 0 {
-							return nil, errors.New("no service principal names provided")
-						}
-						return []interface{}{
-							map[string]interface{}{
-								"id":          "sp-id-1",
-								"appId":       "app-id-1",
-								"displayName": "MyServiceApp",
-								"description": "Service application",
-							},
-						}, nil
-					default:
-						return nil, errors.Errorf("unsupported query type: %s", in.QueryType)
 					}
+					return nil, errors.Errorf("unsupported query type: %s", in.QueryType)
 				},
 			}
 
@@ -2505,3 +2733,3724 @@ func TestRunFunction(t *testing.T) {
 		})
 	}
 }
+
+// TestResolveResourceRef tests the functionality of resolving resourceRef from context, status, or spec
+func TestResolveResourceRef(t *testing.T) {
+	var (
+		xr    = `{"apiVersion":"example.org/v1","kind":"XR","metadata":{"name":"cool-xr"},"spec":{"count":2}}`
+		creds = &fnv1.CredentialData{
+			Data: map[string][]byte{
+				"credentials": []byte(`{
+"clientId": "test-client-id",
+"clientSecret": "test-client-secret",
+"subscriptionId": "test-subscription-id",
+"tenantId": "test-tenant-id"
+}`),
+			},
+		}
+	)
+
+	type args struct {
+		ctx context.Context
+		req *fnv1.RunFunctionRequest
+	}
+	type want struct {
+		rsp *fnv1.RunFunctionResponse
+		err error
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"ResourceRefFromStatus": {
+			reason: "The Function should resolve resourceRef from XR status",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "AppRoleAssignments",
+						"servicePrincipals": ["MyServiceApp"],
+						"resourceRef": "status.resourceInfo.name",
+						"target": "status.appRoles"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"status": {
+									"resourceInfo": {
+										"name": "Microsoft Graph"
+									}
+								}
+							}`),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:   "FunctionSuccess",
+							Status: fnv1.Status_STATUS_CONDITION_TRUE,
+							Reason: "Success",
+							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `QueryType: "AppRoleAssignments"`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"status": {
+									"resourceInfo": {
+										"name": "Microsoft Graph"
+									},
+									"appRoles": [
+										{
+											"id": "assignment-1",
+											"principalDisplayName": "MyServiceApp",
+											"resourceDisplayName": "Microsoft Graph",
+											"appRoleValue": "User.Read.All"
+										}
+									]
+								}
+							}`),
+						},
+					},
+				},
+			},
+		},
+		"ResourceRefFromContext": {
+			reason: "The Function should resolve resourceRef from context",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "AppRoleAssignments",
+						"servicePrincipals": ["MyServiceApp"],
+						"resourceRef": "context.resourceInfo.name",
+						"target": "status.appRoles"
+					}`),
+					Context: resource.MustStructJSON(`{
+						"resourceInfo": {
+							"name": "Microsoft Graph"
+						}
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:   "FunctionSuccess",
+							Status: fnv1.Status_STATUS_CONDITION_TRUE,
+							Reason: "Success",
+							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `QueryType: "AppRoleAssignments"`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Context: resource.MustStructJSON(`{
+						"resourceInfo": {
+							"name": "Microsoft Graph"
+						}
+					}`),
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								},
+								"status": {
+									"appRoles": [
+										{
+											"id": "assignment-1",
+											"principalDisplayName": "MyServiceApp",
+											"resourceDisplayName": "Microsoft Graph",
+											"appRoleValue": "User.Read.All"
+										}
+									]
+								}
+							}`),
+						},
+					},
+				},
+			},
+		},
+		"ResourceRefFromSpec": {
+			reason: "The Function should resolve resourceRef from XR spec",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "AppRoleAssignments",
+						"servicePrincipals": ["MyServiceApp"],
+						"resourceRef": "spec.resourceConfig.name",
+						"target": "status.appRoles"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"spec": {
+									"resourceConfig": {
+										"name": "Microsoft Graph"
+									}
+								}
+							}`),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:   "FunctionSuccess",
+							Status: fnv1.Status_STATUS_CONDITION_TRUE,
+							Reason: "Success",
+							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `QueryType: "AppRoleAssignments"`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"spec": {
+									"resourceConfig": {
+										"name": "Microsoft Graph"
+									}
+								},
+								"status": {
+									"appRoles": [
+										{
+											"id": "assignment-1",
+											"principalDisplayName": "MyServiceApp",
+											"resourceDisplayName": "Microsoft Graph",
+											"appRoleValue": "User.Read.All"
+										}
+									]
+								}
+							}`),
+						},
+					},
+				},
+			},
+		},
+		"ResourceRefNotFound": {
+			reason: "The Function should handle an error when resourceRef cannot be resolved",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "AppRoleAssignments",
+						"servicePrincipals": ["MyServiceApp"],
+						"resourceRef": "context.nonexistent.value",
+						"target": "status.appRoles"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Message:  "cannot resolve resourceRef: context.nonexistent.value not found",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								}
+							}`),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			// Create mock responders for each type of query
+			mockQuery := &MockGraphQuery{
+				GraphQueryFunc: func(_ context.Context, _ map[string]string, in *v1beta1.Input) (interface{}, error) {
+					if in.QueryType == "AppRoleAssignments" {
+						if in.Resource == nil || *in.Resource != "Microsoft Graph" {
+							return nil, errors.New("resource was not resolved")
+						}
+						return []interface{}{
+							map[string]interface{}{
+								"id":                   "assignment-1",
+								"principalDisplayName": *in.ServicePrincipals[0],
+								"resourceDisplayName":  *in.Resource,
+								"appRoleValue":         "User.Read.All",
+							},
+						}, nil
+					}
+					return nil, errors.Errorf("unsupported query type: %s", in.QueryType)
+				},
+			}
+
+			f := &Function{
+				graphQuery: mockQuery,
+				log:        logging.NewNopLogger(),
+			}
+			rsp, err := f.RunFunction(tc.args.ctx, tc.args.req)
+
+			if diff := cmp.Diff(tc.want.rsp, rsp, protocmp.Transform()); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want rsp, +got rsp:\n%s", tc.reason, diff)
+			}
+
+			if diff := cmp.Diff(tc.want.err, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunction(t *testing.T) {
+
+	var (
+		xr    = `{"apiVersion":"example.org/v1","kind":"XR","metadata":{"name":"cool-xr"},"spec":{"count":2}}`
+		creds = &fnv1.CredentialData{
+			Data: map[string][]byte{
+				"credentials": []byte(`{
+"clientId": "test-cliend-id",
+"clientSecret": "test-client-secret",
+"subscriptionId": "test-subscription-id",
+"tenantId": "test-tenant-id"
+}`),
+			},
+		}
+	)
+
+	type args struct {
+		ctx context.Context
+		req *fnv1.RunFunctionRequest
+	}
+	type want struct {
+		rsp *fnv1.RunFunctionResponse
+		err error
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"ResponseIsReturned": {
+			reason: "The Function should fall back to managed identity and still validate the input if no credentials were specified",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "UserValidation",
+						"users": ["user@example.com"]
+					}`),
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Message:  "Unrecognized target field: ",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "",
+								"kind": ""
+							}`),
+						},
+					},
+				},
+			},
+		},
+		"MissingUserValidationTarget": {
+			reason: "The Function should return a fatal result if no target is specified",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "UserValidation",
+						"users": ["user@example.com"]
+					}`),
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Message:  "Unrecognized target field: ",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "",
+								"kind": ""
+							}`),
+						},
+					},
+				},
+			},
+		},
+		"UserValidationMissingUsers": {
+			reason: "The Function should handle UserValidation with missing users",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "UserValidation",
+						"target": "status.validatedUsers"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Message:  "no users provided for validation",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								}
+							}`),
+						},
+					},
+				},
+			},
+		},
+		"UserValidationThrottled": {
+			reason: "The Function should report a Throttled condition and a warning rather than a fatal result if Microsoft Graph kept throttling the query",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "UserValidation",
+						"users": ["throttled@example.com"],
+						"target": "status.validatedUsers"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:    "FunctionSuccess",
+							Status:  fnv1.Status_STATUS_CONDITION_FALSE,
+							Reason:  "Throttled",
+							Message: strPtr("failed to validate user throttled@example.com: request throttled by Microsoft Graph: 429 Too Many Requests after 6 attempts"),
+							Target:  fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_WARNING,
+							Message:  "failed to validate user throttled@example.com: request throttled by Microsoft Graph: 429 Too Many Requests after 6 attempts",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								}
+							}`),
+						},
+					},
+				},
+			},
+		},
+		"SuccessfulUserValidation": {
+			reason: "The Function should handle a successful UserValidation query",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "UserValidation",
+						"users": ["user@example.com"],
+						"target": "status.validatedUsers"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:   "FunctionSuccess",
+							Status: fnv1.Status_STATUS_CONDITION_TRUE,
+							Reason: "Success",
+							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `QueryType: "UserValidation"`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								},
+								"status": {
+									"validatedUsers": [
+										{
+											"id": "test-user-id",
+											"displayName": "Test User",
+											"userPrincipalName": "user@example.com",
+											"mail": "user@example.com"
+										}
+									]
+								}}`),
+						},
+					},
+				},
+			},
+		},
+		"UserValidationOnMissingFail": {
+			reason: "The Function should fail with a ValidationFailed condition listing the users that were not found if onMissing is Fail",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "UserValidation",
+						"users": ["User@Example.com", "ghost@example.com"],
+						"onMissing": "Fail",
+						"target": "status.validatedUsers"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:    "FunctionSuccess",
+							Status:  fnv1.Status_STATUS_CONDITION_FALSE,
+							Reason:  "ValidationFailed",
+							Message: strPtr("UserValidation found no match for: ghost@example.com"),
+							Target:  fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `QueryType: "UserValidation"`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Message:  "UserValidation found no match for: ghost@example.com",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								}
+							}`),
+						},
+					},
+				},
+			},
+		},
+		"UserValidationOnMissingWarn": {
+			reason: "The Function should return the users found and a warning listing the users that were not found if onMissing is Warn",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "UserValidation",
+						"users": ["User@Example.com", "ghost@example.com"],
+						"onMissing": "Warn",
+						"target": "status.validatedUsers"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:   "FunctionSuccess",
+							Status: fnv1.Status_STATUS_CONDITION_TRUE,
+							Reason: "Success",
+							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `QueryType: "UserValidation"`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_WARNING,
+							Message:  "UserValidation found no match for: ghost@example.com",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								},
+								"status": {
+									"validatedUsers": [
+										{
+											"id": "test-user-id",
+											"displayName": "Test User",
+											"userPrincipalName": "user@example.com",
+											"mail": "user@example.com"
+										}
+									]
+								}}`),
+						},
+					},
+				},
+			},
+		},
+		"UserValidationOnMissingFailMaxResults": {
+			reason: "The Function should only warn about the users that were not looked up because the results reached maxResults, even if onMissing is Fail",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "UserValidation",
+						"users": ["User@Example.com", "ghost@example.com"],
+						"onMissing": "Fail",
+						"maxResults": 1,
+						"target": "status.validatedUsers"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:   "FunctionSuccess",
+							Status: fnv1.Status_STATUS_CONDITION_TRUE,
+							Reason: "Success",
+							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `QueryType: "UserValidation"`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_WARNING,
+							Message:  "UserValidation results were truncated to maxResults (1), these were not looked up: ghost@example.com",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								},
+								"status": {
+									"validatedUsers": [
+										{
+											"id": "test-user-id",
+											"displayName": "Test User",
+											"userPrincipalName": "user@example.com",
+											"mail": "user@example.com"
+										}
+									]
+								}}`),
+						},
+					},
+				},
+			},
+		},
+		"InvalidOnMissing": {
+			reason: "The Function should return a fatal result if onMissing is not supported",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "UserValidation",
+						"users": ["user@example.com"],
+						"onMissing": "Panic",
+						"target": "status.validatedUsers"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Message:  "unsupported onMissing: Panic",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								}
+							}`),
+						},
+					},
+				},
+			},
+		},
+		"InvalidLookupBy": {
+			reason: "The Function should return a fatal result if the query type cannot look up names by lookupBy",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "UserValidation",
+						"users": ["user@example.com"],
+						"lookupBy": "appId",
+						"target": "status.validatedUsers"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Message:  "unsupported lookupBy appId for query type UserValidation",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								}
+							}`),
+						},
+					},
+				},
+			},
+		},
+		"InvalidMaxMembers": {
+			reason: "The Function should return a fatal result if maxMembers is below 1, rather than return every member",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "GroupMembership",
+						"group": "Developers",
+						"maxMembers": 0,
+						"target": "status.groupMembers"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Message:  "invalid maxMembers 0: must be at least 1",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								}
+							}`),
+						},
+					},
+				},
+			},
+		},
+		"InvalidMaxResults": {
+			reason: "The Function should return a fatal result if maxResults is below 1, rather than return every result",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "UserValidation",
+						"users": ["user@example.com"],
+						"maxResults": -1,
+						"target": "status.validatedUsers"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Message:  "invalid maxResults -1: must be at least 1",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								}
+							}`),
+						},
+					},
+				},
+			},
+		},
+		"InvalidTop": {
+			reason: "The Function should return a fatal result if top is below 1, as the Input is not validated against its schema",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "Custom",
+						"path": "/groups",
+						"top": 0,
+						"target": "status.groups"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Message:  "invalid top 0: must be at least 1",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								}
+							}`),
+						},
+					},
+				},
+			},
+		},
+		"GroupMembershipMissingGroup": {
+			reason: "The Function should handle GroupMembership with missing group",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "GroupMembership",
+						"target": "status.groupMembers"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Message:  "no group name provided",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								}
+							}`),
+						},
+					},
+				},
+			},
+		},
+		"SuccessfulGroupMembership": {
+			reason: "The Function should handle a successful GroupMembership query",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "GroupMembership",
+						"group": "Developers",
+						"target": "status.groupMembers"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:   "FunctionSuccess",
+							Status: fnv1.Status_STATUS_CONDITION_TRUE,
+							Reason: "Success",
+							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `QueryType: "GroupMembership"`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								},
+								"status": {
+									"groupMembers": [
+										{
+											"id": "sp-id-1",
+											"displayName": "Test Service Principal",
+											"appId": "sp-app-id-1",
+											"type": "servicePrincipal"
+										},
+										{
+											"id": "user-id-1",
+											"displayName": "Test User 1",
+											"mail": "user1@example.com",
+											"type": "user",
+											"userPrincipalName": "user1@example.com"
+										}
+									]
+								}}`),
+						},
+					},
+				},
+			},
+		},
+		"GroupObjectIDsMissingGroups": {
+			reason: "The Function should handle GroupObjectIDs with missing groups",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "GroupObjectIDs",
+						"target": "status.groupObjectIDs"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Message:  "no group names provided",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								}
+							}`),
+						},
+					},
+				},
+			},
+		},
+		"SuccessfulGroupObjectIDs": {
+			reason: "The Function should handle a successful GroupObjectIDs query",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "GroupObjectIDs",
+						"groups": ["Developers", "Operations"],
+						"target": "status.groupObjectIDs"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:   "FunctionSuccess",
+							Status: fnv1.Status_STATUS_CONDITION_TRUE,
+							Reason: "Success",
+							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `QueryType: "GroupObjectIDs"`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								},
+								"status": {
+									"groupObjectIDs": [
+										{
+											"id": "group-id-1",
+											"displayName": "Developers",
+											"description": "Development team"
+										},
+										{
+											"id": "group-id-2",
+											"displayName": "Operations",
+											"description": "Operations team"
+										}
+									]
+								}}`),
+						},
+					},
+				},
+			},
+		},
+		"TruncatedGroupObjectIDs": {
+			reason: "The Function should return a warning alongside the results if the query results were truncated",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "GroupObjectIDs",
+						"groups": ["Developers", "Operations"],
+						"maxResults": 1,
+						"target": "status.groupObjectIDs"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:   "FunctionSuccess",
+							Status: fnv1.Status_STATUS_CONDITION_TRUE,
+							Reason: "Success",
+							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `QueryType: "GroupObjectIDs"`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_WARNING,
+							Message:  "GroupObjectIDs results were truncated to maxResults (1)",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								},
+								"status": {
+									"groupObjectIDs": [
+										{
+											"id": "group-id-1",
+											"displayName": "Developers",
+											"description": "Development team"
+										}
+									]
+								}}`),
+						},
+					},
+				},
+			},
+		},
+		"SuccessfulGroupOwners": {
+			reason: "The Function should handle a successful GroupOwners query",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "GroupOwners",
+						"groups": ["Developers"],
+						"target": "status.groupOwners"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:   "FunctionSuccess",
+							Status: fnv1.Status_STATUS_CONDITION_TRUE,
+							Reason: "Success",
+							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `QueryType: "GroupOwners"`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								},
+								"status": {
+									"groupOwners": [
+										{
+											"id": "group-id-1",
+											"displayName": "Developers",
+											"owners": [
+												{
+													"id": "user-id-1",
+													"displayName": "Test User 1",
+													"userPrincipalName": "user1@example.com",
+													"type": "user"
+												}
+											]
+										}
+									]
+								}}`),
+						},
+					},
+				},
+			},
+		},
+		"SuccessfulApplicationDetails": {
+			reason: "The Function should handle a successful ApplicationDetails query",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "ApplicationDetails",
+						"applications": ["MyApp"],
+						"target": "status.applicationDetails"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:   "FunctionSuccess",
+							Status: fnv1.Status_STATUS_CONDITION_TRUE,
+							Reason: "Success",
+							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `QueryType: "ApplicationDetails"`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								},
+								"status": {
+									"applicationDetails": [
+										{
+											"id": "app-object-id-1",
+											"appId": "app-id-1",
+											"displayName": "MyApp",
+											"signInAudience": "AzureADMyOrg",
+											"passwordCredentials": [
+												{
+													"keyId": "key-id-1",
+													"endDateTime": "2026-01-01T00:00:00Z"
+												}
+											]
+										}
+									]
+								}}`),
+						},
+					},
+				},
+			},
+		},
+		"SuccessfulUserMemberOf": {
+			reason: "The Function should handle a successful UserMemberOf query",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "UserMemberOf",
+						"users": ["user1@example.com"],
+						"target": "status.memberships"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:   "FunctionSuccess",
+							Status: fnv1.Status_STATUS_CONDITION_TRUE,
+							Reason: "Success",
+							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `QueryType: "UserMemberOf"`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								},
+								"status": {
+									"memberships": {
+										"user1@example.com": {
+											"id": "user-id-1",
+											"displayName": "Test User 1",
+											"userPrincipalName": "user1@example.com",
+											"groups": [
+												{
+													"id": "group-id-1",
+													"displayName": "Developers",
+													"description": "Development team"
+												}
+											],
+											"directoryRoles": [
+												{
+													"id": "role-id-1",
+													"displayName": "Global Reader",
+													"roleTemplateId": "template-id-1"
+												}
+											]
+										}
+									}
+								}}`),
+						},
+					},
+				},
+			},
+		},
+		"SuccessfulCheckMembership": {
+			reason: "The Function should handle a successful CheckMembership query",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "CheckMembership",
+						"principal": "user1@example.com",
+						"groups": ["Developers", "Operations"],
+						"target": "status.membership"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:   "FunctionSuccess",
+							Status: fnv1.Status_STATUS_CONDITION_TRUE,
+							Reason: "Success",
+							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `QueryType: "CheckMembership"`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								},
+								"status": {
+									"membership": {
+										"Developers": true,
+										"Operations": false
+									}
+								}}`),
+						},
+					},
+				},
+			},
+		},
+		"SuccessfulDirectoryRoleAssignments": {
+			reason: "The Function should handle a successful DirectoryRoleAssignments query",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "DirectoryRoleAssignments",
+						"role": "Global Reader",
+						"target": "status.roleHolders"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:   "FunctionSuccess",
+							Status: fnv1.Status_STATUS_CONDITION_TRUE,
+							Reason: "Success",
+							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `QueryType: "DirectoryRoleAssignments"`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								},
+								"status": {
+									"roleHolders": [
+										{
+											"id": "assignment-id-1",
+											"principalId": "group-id-1",
+											"roleDefinitionId": "role-id-1",
+											"directoryScopeId": "/",
+											"roleName": "Global Reader",
+											"roleTemplateId": "role-template-id-1",
+											"isBuiltIn": true,
+											"principal": {
+												"id": "group-id-1",
+												"displayName": "Readers",
+												"type": "group"
+											}
+										}
+									]
+								}}`),
+						},
+					},
+				},
+			},
+		},
+		"SuccessfulAppRoleAssignments": {
+			reason: "The Function should handle a successful AppRoleAssignments query",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "AppRoleAssignments",
+						"servicePrincipals": ["MyServiceApp"],
+						"target": "status.appRoles"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:   "FunctionSuccess",
+							Status: fnv1.Status_STATUS_CONDITION_TRUE,
+							Reason: "Success",
+							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `QueryType: "AppRoleAssignments"`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								},
+								"status": {
+									"appRoles": [
+										{
+											"id": "assignment-id-1",
+											"principalId": "sp-id-1",
+											"principalDisplayName": "MyServiceApp",
+											"principalType": "ServicePrincipal",
+											"resourceId": "graph-sp-id",
+											"resourceDisplayName": "Microsoft Graph",
+											"appRoleId": "app-role-id-1",
+											"appRoleValue": "User.Read.All",
+											"appRoleDisplayName": "Read all users' full profiles",
+											"createdDateTime": "2025-01-01T00:00:00Z"
+										}
+									]
+								}}`),
+						},
+					},
+				},
+			},
+		},
+		"SuccessfulOAuth2PermissionGrants": {
+			reason: "The Function should handle a successful OAuth2PermissionGrants query",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "OAuth2PermissionGrants",
+						"servicePrincipals": ["MyServiceApp"],
+						"target": "status.delegatedPermissions"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:   "FunctionSuccess",
+							Status: fnv1.Status_STATUS_CONDITION_TRUE,
+							Reason: "Success",
+							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `QueryType: "OAuth2PermissionGrants"`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								},
+								"status": {
+									"delegatedPermissions": [
+										{
+											"id": "grant-id-1",
+											"clientId": "sp-id-1",
+											"resourceId": "graph-sp-id",
+											"principalId": "user-id-1",
+											"consentType": "Principal",
+											"scope": "openid User.Read",
+											"scopes": ["openid", "User.Read"]
+										}
+									]
+								}}`),
+						},
+					},
+				},
+			},
+		},
+		"SuccessfulCustom": {
+			reason: "The Function should handle a successful Custom query",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "Custom",
+						"path": "/groups",
+						"filter": "startsWith(displayName,'platform-')",
+						"select": ["id", "displayName"],
+						"target": "status.platformGroups"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:   "FunctionSuccess",
+							Status: fnv1.Status_STATUS_CONDITION_TRUE,
+							Reason: "Success",
+							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `QueryType: "Custom"`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								},
+								"status": {
+									"platformGroups": [
+										{
+											"id": "group-id-1",
+											"displayName": "platform-dev"
+										}
+									]
+								}}`),
+						},
+					},
+				},
+			},
+		},
+		"ServicePrincipalDetailsMissingNames": {
+			reason: "The Function should handle ServicePrincipalDetails with missing names",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "ServicePrincipalDetails",
+						"target": "status.servicePrincipals"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Message:  "no service principal names provided",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								}
+							}`),
+						},
+					},
+				},
+			},
+		},
+		"SuccessfulServicePrincipalDetails": {
+			reason: "The Function should handle a successful ServicePrincipalDetails query",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "ServicePrincipalDetails",
+						"servicePrincipals": ["MyServiceApp"],
+						"target": "status.servicePrincipals"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:   "FunctionSuccess",
+							Status: fnv1.Status_STATUS_CONDITION_TRUE,
+							Reason: "Success",
+							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `QueryType: "ServicePrincipalDetails"`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								},
+								"status": {
+									"servicePrincipals": [
+										{
+											"id": "sp-id-1",
+											"appId": "app-id-1",
+											"displayName": "MyServiceApp",
+											"description": "Service application"
+										}
+									]
+								}}`),
+						},
+					},
+				},
+			},
+		},
+		"CustomPathNotAllowed": {
+			reason: "The Function should return a fatal result if a Custom query reads a path that is not allowed",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "Custom",
+						"path": "/me",
+						"target": "status.me"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Message:  "path /me is not allowed, allowed path prefixes are: /users, /groups, /servicePrincipals, /applications, /directoryRoles, /roleManagement/directory, /organization, /domains",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								}
+							}`),
+						},
+					},
+				},
+			},
+		},
+		"InvalidQueryType": {
+			reason: "The Function should handle an invalid query type",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "InvalidType",
+						"target": "status.invalidResult"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Message:  "unsupported query type: InvalidType",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								}
+							}`),
+						},
+					},
+				},
+			},
+		},
+		"ShouldSkipQueryWhenStatusTargetHasData": {
+			reason: "The Function should skip query when status target already has data",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "UserValidation",
+						"users": ["user@example.com"],
+						"target": "status.validatedUsers",
+						"skipQueryWhenTargetHasData": true
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"status": {
+									"validatedUsers": [
+										{
+											"id": "existing-user-id",
+											"displayName": "Existing User",
+											"userPrincipalName": "existing@example.com",
+											"mail": "existing@example.com"
+										}
+									]
+								}
+							}`),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:    "FunctionSkip",
+							Message: strPtr("Target already has data, skipped query to avoid throttling"),
+							Status:  fnv1.Status_STATUS_CONDITION_TRUE,
+							Reason:  "SkippedQuery",
+							Target:  fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+						{
+							Type:   "FunctionSuccess",
+							Status: fnv1.Status_STATUS_CONDITION_TRUE,
+							Reason: "Success",
+							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"status": {
+									"validatedUsers": [
+										{
+											"id": "existing-user-id",
+											"displayName": "Existing User",
+											"userPrincipalName": "existing@example.com",
+											"mail": "existing@example.com"
+										}
+									]
+								}}`),
+						},
+					},
+				},
+			},
+		},
+		"QueryToContextField": {
+			reason: "The Function should store results in context field",
+			args: args{
+				ctx: context.Background(),
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+						"kind": "Input",
+						"queryType": "UserValidation",
+						"users": ["user@example.com"],
+						"target": "context.validatedUsers"
+					}`),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(xr),
+						},
+					},
+					Credentials: map[string]*fnv1.Credentials{
+						"azure-creds": {
+							Source: &fnv1.Credentials_CredentialData{CredentialData: creds},
+						},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{
+						{
+							Type:   "FunctionSuccess",
+							Status: fnv1.Status_STATUS_CONDITION_TRUE,
+							Reason: "Success",
+							Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `QueryType: "UserValidation"`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Context: resource.MustStructJSON(
+						`{
+							"validatedUsers": [
+								{
+									"id": "test-user-id",
+									"displayName": "Test User",
+									"userPrincipalName": "user@example.com",
+									"mail": "user@example.com"
+								}
+							]
+						}`,
+					),
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{
+							Resource: resource.MustStructJSON(`{
+								"apiVersion": "example.org/v1",
+								"kind": "XR",
+								"metadata": {
+									"name": "cool-xr"
+								},
+								"spec": {
+									"count": 2
+								}
+							}`),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			// Create mock responders for each type of query
+			mockQuery := &MockGraphQuery{
+				GraphQueryFunc: func(ctx context.Context, _ map[string]string, in *v1beta1.Input) (interface{}, error) {
+					switch in.QueryType {
+					case "UserValidation":
+						if len(in.Users) == 0 {
+							return nil, errors.New("no users provided for validation")
+						}
+						if *in.Users[0] == "throttled@example.com" {
+							return nil, errors.Wrap(&throttledError{statusCode: 429, attempts: 6}, "failed to validate user throttled@example.com")
+						}
+						return []interface{}{
+							map[string]interface{}{
+								"id":                "test-user-id",
+								"displayName":       "Test User",
+								"userPrincipalName": "user@example.com",
+								"mail":              "user@example.com",
+							},
+						}, nil
+					case "GroupMembership":
+						if in.Group == nil || *in.Group == "" {
+							return nil, errors.New("no group name provided")
+						}
+						return []interface{}{
+							map[string]interface{}{
+								"id":                "user-id-1",
+								"displayName":       "Test User 1",
+								"mail":              "user1@example.com",
+								"userPrincipalName": "user1@example.com",
+								"type":              "user",
+							},
+							map[string]interface{}{
+								"id":          "sp-id-1",
+								"displayName": "Test Service Principal",
+								"appId":       "sp-app-id-1",
+								"type":        "servicePrincipal",
+							},
+						}, nil
+					case "GroupObjectIDs":
+						if len(in.Groups) == 0 {
+							return nil, errors.New("no group names provided")
+						}
+						results := []interface{}{
+							map[string]interface{}{
+								"id":          "group-id-1",
+								"displayName": "Developers",
+								"description": "Development team",
+							},
+							map[string]interface{}{
+								"id":          "group-id-2",
+								"displayName": "Operations",
+								"description": "Operations team",
+							},
+						}
+						if in.MaxResults != nil && *in.MaxResults < len(results) {
+							addQueryWarning(ctx, "%s results were truncated to maxResults (%d)", in.QueryType, *in.MaxResults)
+							results = results[:*in.MaxResults]
+						}
+						return results, nil
+					case "GroupOwners":
+						if len(in.Groups) == 0 {
+							return nil, errors.New("no group names provided")
+						}
+						return []interface{}{
+							map[string]interface{}{
+								"id":          "group-id-1",
+								"displayName": "Developers",
+								"owners": []interface{}{
+									map[string]interface{}{
+										"id":                "user-id-1",
+										"displayName":       "Test User 1",
+										"userPrincipalName": "user1@example.com",
+										"type":              "user",
+									},
+								},
+							},
+						}, nil
+					case "ServicePrincipalDetails":
+						if len(in.ServicePrincipals) == 0 {
+							return nil, errors.New("no service principal names provided")
+						}
+						return []interface{}{
+							map[string]interface{}{
+								"id":          "sp-id-1",
+								"appId":       "app-id-1",
+								"displayName": "MyServiceApp",
+								"description": "Service application",
+							},
+						}, nil
+					case "ApplicationDetails":
+						if len(in.Applications) == 0 {
+							return nil, errors.New("no application names provided")
+						}
+						return []interface{}{
+							map[string]interface{}{
+								"id":             "app-object-id-1",
+								"appId":          "app-id-1",
+								"displayName":    "MyApp",
+								"signInAudience": "AzureADMyOrg",
+								"passwordCredentials": []interface{}{
+									map[string]interface{}{
+										"keyId":       "key-id-1",
+										"endDateTime": "2026-01-01T00:00:00Z",
+									},
+								},
+							},
+						}, nil
+					case "UserMemberOf":
+						if len(in.Users) == 0 {
+							return nil, errors.New("no users provided")
+						}
+						return map[string]interface{}{
+							"user1@example.com": map[string]interface{}{
+								"id":                "user-id-1",
+								"displayName":       "Test User 1",
+								"userPrincipalName": "user1@example.com",
+								"groups": []interface{}{
+									map[string]interface{}{
+										"id":          "group-id-1",
+										"displayName": "Developers",
+										"description": "Development team",
+									},
+								},
+								"directoryRoles": []interface{}{
+									map[string]interface{}{
+										"id":             "role-id-1",
+										"displayName":    "Global Reader",
+										"roleTemplateId": "template-id-1",
+									},
+								},
+							},
+						}, nil
+					case "CheckMembership":
+						if in.Principal == nil || *in.Principal == "" {
+							return nil, errors.New("no principal provided")
+						}
+						return map[string]interface{}{
+							"Developers": true,
+							"Operations": false,
+						}, nil
+					case "DirectoryRoleAssignments":
+						if in.Role == nil || *in.Role == "" {
+							return nil, errors.New("no principal or role provided")
+						}
+						return []interface{}{
+							map[string]interface{}{
+								"id":               "assignment-id-1",
+								"principalId":      "group-id-1",
+								"roleDefinitionId": "role-id-1",
+								"directoryScopeId": "/",
+								"roleName":         "Global Reader",
+								"roleTemplateId":   "role-template-id-1",
+								"isBuiltIn":        true,
+								"principal": map[string]interface{}{
+									"id":          "group-id-1",
+									"displayName": "Readers",
+									"type":        "group",
+								},
+							},
+						}, nil
+					case "AppRoleAssignments":
+						if len(in.ServicePrincipals) == 0 {
+							return nil, errors.New("no service principal names or resource provided")
+						}
+						return []interface{}{
+							map[string]interface{}{
+								"id":                   "assignment-id-1",
+								"principalId":          "sp-id-1",
+								"principalDisplayName": "MyServiceApp",
+								"principalType":        "ServicePrincipal",
+								"resourceId":           "graph-sp-id",
+								"resourceDisplayName":  "Microsoft Graph",
+								"appRoleId":            "app-role-id-1",
+								"appRoleValue":         "User.Read.All",
+								"appRoleDisplayName":   "Read all users' full profiles",
+								"createdDateTime":      "2025-01-01T00:00:00Z",
+							},
+						}, nil
+					case "OAuth2PermissionGrants":
+						if len(in.ServicePrincipals) == 0 {
+							return nil, errors.New("no service principal names provided")
+						}
+						return []interface{}{
+							map[string]interface{}{
+								"id":          "grant-id-1",
+								"clientId":    "sp-id-1",
+								"resourceId":  "graph-sp-id",
+								"principalId": "user-id-1",
+								"consentType": "Principal",
+								"scope":       "openid User.Read",
+								"scopes":      []interface{}{"openid", "User.Read"},
+							},
+						}, nil
+					case "Custom":
+						if in.Path == nil || *in.Path == "" {
+							return nil, errors.New("no path provided")
+						}
+						if _, err := customPath(*in.Path, defaultCustomPathPrefixes); err != nil {
+							return nil, err
+						}
+						return []interface{}{
+							map[string]interface{}{
+								"id":          "group-id-1",
+								"displayName": "platform-dev",
+							},
+						}, nil
+					default:
+						return nil, errors.Errorf("unsupported query type: %s", in.QueryType)
+					}
+				},
+			}
+
+			f := &Function{
+				graphQuery: mockQuery,
+				log:        logging.NewNopLogger(),
+			}
+			rsp, err := f.RunFunction(tc.args.ctx, tc.args.req)
+
+			if diff := cmp.Diff(tc.want.rsp, rsp, protocmp.Transform()); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want rsp, +got rsp:\n%s", tc.reason, diff)
+			}
+
+			if diff := cmp.Diff(tc.want.err, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetGroupMembersTransitive(t *testing.T) {
+	// Developers contains Platform, which contains SRE, which contains Developers again
+	client := newFakeGraphClient(t, map[string]string{
+		"/v1.0/groups?$filter=displayName eq 'Developers'": `{"value": [{"id": "group-1", "displayName": "Developers"}]}`,
+		"/v1.0/groups/group-1/transitiveMembers": `{
+			"value": [
+				{"@odata.type": "#microsoft.graph.user", "id": "user-1", "displayName": "User 1"},
+				{"@odata.type": "#microsoft.graph.group", "id": "group-2", "displayName": "Platform"},
+				{"@odata.type": "#microsoft.graph.user", "id": "user-2", "displayName": "User 2"},
+				{"@odata.type": "#microsoft.graph.group", "id": "group-3", "displayName": "SRE"}
+			]
+		}`,
+		"/v1.0/groups/group-1/transitiveMembers/graph.servicePrincipal": `{
+			"value": [
+				{"@odata.type": "#microsoft.graph.servicePrincipal", "id": "sp-1", "displayName": "SP 1", "appId": "app-1"}
+			]
+		}`,
+		"/v1.0/groups/group-1/members": `{
+			"value": [
+				{"@odata.type": "#microsoft.graph.user", "id": "user-1"},
+				{"@odata.type": "#microsoft.graph.group", "id": "group-2"}
+			]
+		}`,
+		"/v1.0/groups/group-1/members/graph.servicePrincipal": `{"value": []}`,
+		"/v1.0/groups/group-2/members": `{
+			"value": [
+				{"@odata.type": "#microsoft.graph.user", "id": "user-1"},
+				{"@odata.type": "#microsoft.graph.user", "id": "user-2"},
+				{"@odata.type": "#microsoft.graph.group", "id": "group-3"}
+			]
+		}`,
+		"/v1.0/groups/group-2/members/graph.servicePrincipal": `{"value": []}`,
+		"/v1.0/groups/group-3/members": `{
+			"value": [
+				{"@odata.type": "#microsoft.graph.group", "id": "group-1"}
+			]
+		}`,
+		"/v1.0/groups/group-3/members/graph.servicePrincipal": `{
+			"value": [
+				{"@odata.type": "#microsoft.graph.servicePrincipal", "id": "sp-1"}
+			]
+		}`,
+	})
+
+	g := &GraphQuery{}
+	results, err := g.getGroupMembers(context.Background(), client, &v1beta1.Input{
+		QueryType:      "GroupMembership",
+		Group:          strPtr("Developers"),
+		Transitive:     boolPtr(true),
+		ResolveNesting: boolPtr(true),
+	})
+	if err != nil {
+		t.Fatalf("getGroupMembers(...): unexpected error: %v", err)
+	}
+
+	var got []string
+	for _, result := range results.([]interface{}) {
+		member := result.(map[string]interface{})
+		got = append(got, fmt.Sprintf("%s:%s depth %v via %v (%v)",
+			member["type"], member["id"], member["depth"], member["parentGroupName"], member["parentGroupId"]))
+	}
+
+	want := []string{
+		"user:user-1 depth 1 via Developers (group-1)",
+		"group:group-2 depth 1 via Developers (group-1)",
+		"user:user-2 depth 2 via Platform (group-2)",
+		"group:group-3 depth 2 via Platform (group-2)",
+		"servicePrincipal:sp-1 depth 3 via SRE (group-3)",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("getGroupMembers(...): transitive members should report the depth and parent group they came through: -want, +got:\n%s", diff)
+	}
+}
+
+func TestGetGroupMembersTransitiveWithoutNesting(t *testing.T) {
+	// Only the transitive members are served, listing the direct members of a group would fail
+	client := newFakeGraphClient(t, map[string]string{
+		"/v1.0/groups?$filter=displayName eq 'Developers'": `{"value": [{"id": "group-1", "displayName": "Developers"}]}`,
+		"/v1.0/groups/group-1/transitiveMembers": `{
+			"value": [
+				{"@odata.type": "#microsoft.graph.user", "id": "user-1", "displayName": "User 1"},
+				{"@odata.type": "#microsoft.graph.group", "id": "group-2", "displayName": "Platform"}
+			]
+		}`,
+		"/v1.0/groups/group-1/transitiveMembers/graph.servicePrincipal": `{"value": []}`,
+	})
+
+	g := &GraphQuery{}
+	results, err := g.getGroupMembers(context.Background(), client, &v1beta1.Input{
+		QueryType:  "GroupMembership",
+		Group:      strPtr("Developers"),
+		Transitive: boolPtr(true),
+	})
+	if err != nil {
+		t.Fatalf("getGroupMembers(...): transitive members should be returned without listing the members of nested groups: %v", err)
+	}
+
+	for _, result := range results.([]interface{}) {
+		member := result.(map[string]interface{})
+		if _, ok := member["depth"]; ok {
+			t.Errorf("getGroupMembers(...): members should not report their depth unless resolveNesting is set, got %v", member)
+		}
+	}
+}
+
+func TestGetGroupOwners(t *testing.T) {
+	client := newFakeGraphClient(t, map[string]string{
+		"/v1.0/groups?$filter=displayName eq 'Developers'": `{"value": [{"id": "group-1", "displayName": "Developers"}]}`,
+		"/v1.0/groups?$filter=displayName eq 'Operations'": `{"value": [{"id": "group-2", "displayName": "Operations"}]}`,
+		"/v1.0/groups?$filter=displayName eq 'Hidden'":     `{"value": [{"id": "group-3", "displayName": "Hidden"}]}`,
+		"/v1.0/groups?$filter=displayName eq 'Missing'":    `{"value": []}`,
+		"/v1.0/groups/group-1/owners": `{
+			"value": [
+				{"@odata.type": "#microsoft.graph.user", "id": "user-1", "displayName": "User 1"}
+			],
+			"@odata.nextLink": "{{server}}/v1.0/groups/group-1/owners?$skiptoken=page-2"
+		}`,
+		"/v1.0/groups/group-1/owners?$skiptoken=page-2": `{
+			"value": [
+				{"@odata.type": "#microsoft.graph.servicePrincipal", "id": "sp-1", "displayName": "SP 1"}
+			]
+		}`,
+		"/v1.0/groups/group-2/owners": `{"value": []}`,
+	})
+
+	type want struct {
+		owners []string
+		err    string
+	}
+
+	cases := map[string]struct {
+		reason string
+		in     *v1beta1.Input
+		want   want
+	}{
+		"Owners": {
+			reason: "Owners on every page of every group should be returned",
+			in: &v1beta1.Input{
+				QueryType: "GroupOwners",
+				Groups:    []*string{strPtr("Developers"), strPtr("Operations")},
+			},
+			want: want{owners: []string{
+				"Developers (group-1): user user-1 (User 1)",
+				"Developers (group-1): servicePrincipal sp-1 (SP 1)",
+				"Operations (group-2): no owners",
+			}},
+		},
+		"NoOwners": {
+			reason: "A group without owners should be returned with an empty list of owners",
+			in: &v1beta1.Input{
+				QueryType: "GroupOwners",
+				Groups:    []*string{strPtr("Operations")},
+			},
+			want: want{owners: []string{"Operations (group-2): no owners"}},
+		},
+		"GroupNotFound": {
+			reason: "A group that does not exist should fail the query",
+			in: &v1beta1.Input{
+				QueryType: "GroupOwners",
+				Groups:    []*string{strPtr("Developers"), strPtr("Missing")},
+			},
+			want: want{err: "group not found: Missing"},
+		},
+		"OwnersNotReadable": {
+			reason: "An error reading the owners of a group should fail the query",
+			in: &v1beta1.Input{
+				QueryType: "GroupOwners",
+				Groups:    []*string{strPtr("Hidden")},
+			},
+			want: want{err: "failed to get owners for group Hidden: Resource '/v1.0/groups/group-3/owners' does not exist."},
+		},
+		"NoGroups": {
+			reason: "A query without groups should fail",
+			in:     &v1beta1.Input{QueryType: "GroupOwners"},
+			want:   want{err: "no group names provided"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			g := &GraphQuery{}
+			results, err := g.getGroupOwners(context.Background(), client, tc.in)
+
+			if diff := cmp.Diff(tc.want.err, errString(err)); diff != "" {
+				t.Fatalf("%s\ngetGroupOwners(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+
+			var got []string
+			list, _ := results.([]interface{})
+			for _, result := range list {
+				group := result.(map[string]interface{})
+				for _, owner := range group["owners"].([]interface{}) {
+					o := owner.(map[string]interface{})
+					got = append(got, fmt.Sprintf("%s (%s): %s %s (%s)", group["displayName"], group["id"], o["type"], o["id"], o["displayName"]))
+				}
+				if len(group["owners"].([]interface{})) == 0 {
+					got = append(got, fmt.Sprintf("%s (%s): no owners", group["displayName"], group["id"]))
+				}
+			}
+			if diff := cmp.Diff(tc.want.owners, got); diff != "" {
+				t.Errorf("%s\ngetGroupOwners(...): -want owners, +got owners:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetApplicationDetails(t *testing.T) {
+	client := newFakeGraphClient(t, map[string]string{
+		"/v1.0/applications?$filter=displayName eq 'My App'": `{
+			"value": [{
+				"id": "app-object-1",
+				"appId": "11111111-1111-1111-1111-111111111111",
+				"displayName": "My App",
+				"identifierUris": ["api://my-app"],
+				"signInAudience": "AzureADMyOrg",
+				"requiredResourceAccess": [{
+					"resourceAppId": "00000003-0000-0000-c000-000000000000",
+					"resourceAccess": [{"id": "e1fe6dd8-ba31-4d61-89e7-88639da4683d", "type": "Scope"}]
+				}],
+				"appRoles": [{
+					"id": "22222222-2222-2222-2222-222222222222",
+					"value": "Reader",
+					"displayName": "Reader",
+					"description": "Can read",
+					"allowedMemberTypes": ["User"],
+					"isEnabled": true
+				}],
+				"passwordCredentials": [{
+					"keyId": "33333333-3333-3333-3333-333333333333",
+					"displayName": "ci",
+					"startDateTime": "2025-01-01T00:00:00Z",
+					"endDateTime": "2026-01-01T00:00:00Z"
+				}],
+				"keyCredentials": [{
+					"keyId": "44444444-4444-4444-4444-444444444444",
+					"displayName": "CN=my-app",
+					"type": "AsymmetricX509Cert",
+					"usage": "Verify",
+					"endDateTime": "2027-06-30T12:00:00Z"
+				}]
+			}]
+		}`,
+		"/v1.0/applications?$filter=appId eq '55555555-5555-5555-5555-555555555555'": `{
+			"value": [{"id": "app-object-2", "appId": "55555555-5555-5555-5555-555555555555", "displayName": "Other App"}]
+		}`,
+		"/v1.0/applications?$filter=displayName eq 'Other App'": `{
+			"value": [{"id": "app-object-2", "appId": "55555555-5555-5555-5555-555555555555", "displayName": "Other App"}]
+		}`,
+		"/v1.0/applications?$filter=displayName eq 'Missing App'": `{"value": []}`,
+	})
+
+	myApp := map[string]interface{}{
+		"id":             "app-object-1",
+		"appId":          "11111111-1111-1111-1111-111111111111",
+		"displayName":    "My App",
+		"identifierUris": []interface{}{"api://my-app"},
+		"signInAudience": "AzureADMyOrg",
+		"requiredResourceAccess": []interface{}{
+			map[string]interface{}{
+				"resourceAppId": "00000003-0000-0000-c000-000000000000",
+				"resourceAccess": []interface{}{
+					map[string]interface{}{"id": "e1fe6dd8-ba31-4d61-89e7-88639da4683d", "type": "Scope"},
+				},
+			},
+		},
+		"appRoles": []interface{}{
+			map[string]interface{}{
+				"id":                 "22222222-2222-2222-2222-222222222222",
+				"value":              "Reader",
+				"displayName":        "Reader",
+				"description":        "Can read",
+				"allowedMemberTypes": []interface{}{"User"},
+				"isEnabled":          true,
+			},
+		},
+		"passwordCredentials": []interface{}{
+			map[string]interface{}{
+				"keyId":         "33333333-3333-3333-3333-333333333333",
+				"displayName":   "ci",
+				"startDateTime": "2025-01-01T00:00:00Z",
+				"endDateTime":   "2026-01-01T00:00:00Z",
+			},
+		},
+		"keyCredentials": []interface{}{
+			map[string]interface{}{
+				"keyId":         "44444444-4444-4444-4444-444444444444",
+				"displayName":   "CN=my-app",
+				"type":          "AsymmetricX509Cert",
+				"usage":         "Verify",
+				"startDateTime": nil,
+				"endDateTime":   "2027-06-30T12:00:00Z",
+			},
+		},
+	}
+
+	otherApp := map[string]interface{}{
+		"id":                     "app-object-2",
+		"appId":                  "55555555-5555-5555-5555-555555555555",
+		"displayName":            "Other App",
+		"identifierUris":         []interface{}{},
+		"signInAudience":         nil,
+		"requiredResourceAccess": []interface{}{},
+		"appRoles":               []interface{}{},
+		"passwordCredentials":    []interface{}{},
+		"keyCredentials":         []interface{}{},
+	}
+
+	type want struct {
+		results interface{}
+		err     string
+	}
+
+	cases := map[string]struct {
+		reason string
+		in     *v1beta1.Input
+		want   want
+	}{
+		"ByNameOrAppID": {
+			reason: "Applications should be found by display name, or by app ID if the name is a GUID",
+			in: &v1beta1.Input{
+				QueryType:    "ApplicationDetails",
+				Applications: []*string{strPtr("My App"), strPtr("55555555-5555-5555-5555-555555555555")},
+			},
+			want: want{results: []interface{}{myApp, otherApp}},
+		},
+		"NotFound": {
+			reason: "Applications that do not exist should be left out",
+			in: &v1beta1.Input{
+				QueryType:    "ApplicationDetails",
+				Applications: []*string{strPtr("Missing App"), strPtr("Other App")},
+			},
+			want: want{results: []interface{}{otherApp}},
+		},
+		"NotFoundByID": {
+			reason: "An application looked up by an object ID that does not exist should be left out rather than fail",
+			in: &v1beta1.Input{
+				QueryType:    "ApplicationDetails",
+				LookupBy:     "id",
+				Applications: []*string{strPtr("66666666-6666-6666-6666-666666666666")},
+			},
+			want: want{results: []interface{}(nil)},
+		},
+		"InvalidID": {
+			reason: "An application looked up by an object ID that is not a GUID should fail",
+			in: &v1beta1.Input{
+				QueryType:    "ApplicationDetails",
+				LookupBy:     "id",
+				Applications: []*string{strPtr("my-app")},
+			},
+			want: want{err: "failed to find application my-app: invalid id: value must be a GUID"},
+		},
+		"LookupError": {
+			reason: "An error looking up an application should fail the query",
+			in: &v1beta1.Input{
+				QueryType:    "ApplicationDetails",
+				Applications: []*string{strPtr("Broken App")},
+			},
+			want: want{err: "failed to find application Broken App: Resource '/v1.0/applications?$filter=displayName eq 'Broken App'' does not exist."},
+		},
+		"NoApplications": {
+			reason: "A query without applications should fail",
+			in:     &v1beta1.Input{QueryType: "ApplicationDetails"},
+			want:   want{err: "no application names provided"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			g := &GraphQuery{}
+			results, err := g.getApplicationDetails(context.Background(), client, tc.in)
+
+			if diff := cmp.Diff(tc.want.results, results); diff != "" {
+				t.Errorf("%s\ngetApplicationDetails(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, errString(err)); diff != "" {
+				t.Errorf("%s\ngetApplicationDetails(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetUserMemberOf(t *testing.T) {
+	client := newFakeGraphClient(t, map[string]string{
+		"/v1.0/users?$filter=userPrincipalName eq 'user1@example.com'": `{
+			"value": [{"id": "user-1", "displayName": "User 1", "userPrincipalName": "user1@example.com"}]
+		}`,
+		"/v1.0/users?$filter=userPrincipalName eq 'user2@example.com'": `{
+			"value": [{"id": "user-2", "displayName": "User 2", "userPrincipalName": "user2@example.com"}]
+		}`,
+		"/v1.0/users?$filter=userPrincipalName eq 'hidden@example.com'": `{
+			"value": [{"id": "user-3", "displayName": "User 3", "userPrincipalName": "hidden@example.com"}]
+		}`,
+		"/v1.0/users?$filter=userPrincipalName eq 'missing@example.com'": `{"value": []}`,
+		"/v1.0/users/user-1/transitiveMemberOf": `{
+			"value": [
+				{"@odata.type": "#microsoft.graph.group", "id": "group-1", "displayName": "Developers", "description": "Development team"},
+				{"@odata.type": "#microsoft.graph.administrativeUnit", "id": "au-1", "displayName": "Europe"}
+			],
+			"@odata.nextLink": "{{server}}/v1.0/users/user-1/transitiveMemberOf?$skiptoken=page-2"
+		}`,
+		"/v1.0/users/user-1/transitiveMemberOf?$skiptoken=page-2": `{
+			"value": [
+				{"@odata.type": "#microsoft.graph.directoryRole", "id": "role-1", "displayName": "Global Reader", "roleTemplateId": "template-1"}
+			]
+		}`,
+		"/v1.0/users/user-2/memberOf": `{"value": []}`,
+	})
+
+	user1 := func(groups, roles []interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"id":                "user-1",
+			"displayName":       "User 1",
+			"userPrincipalName": "user1@example.com",
+			"groups":            groups,
+			"directoryRoles":    roles,
+		}
+	}
+	developers := map[string]interface{}{"id": "group-1", "displayName": "Developers", "description": "Development team"}
+	globalReader := map[string]interface{}{"id": "role-1", "displayName": "Global Reader", "roleTemplateId": "template-1"}
+
+	type want struct {
+		results  interface{}
+		warnings []string
+		err      string
+	}
+
+	cases := map[string]struct {
+		reason string
+		in     *v1beta1.Input
+		want   want
+	}{
+		"Transitive": {
+			reason: "Groups and roles on every page should be returned keyed by user principal name, leaving out users that do not exist",
+			in: &v1beta1.Input{
+				QueryType:  "UserMemberOf",
+				Users:      []*string{strPtr("user1@example.com"), strPtr("missing@example.com")},
+				Transitive: boolPtr(true),
+			},
+			want: want{results: map[string]interface{}{
+				"user1@example.com": user1([]interface{}{developers}, []interface{}{globalReader}),
+			}},
+		},
+		"NoMemberships": {
+			reason: "A user that belongs to nothing directly should be returned with empty lists",
+			in: &v1beta1.Input{
+				QueryType: "UserMemberOf",
+				Users:     []*string{strPtr("user2@example.com")},
+			},
+			want: want{results: map[string]interface{}{
+				"user2@example.com": map[string]interface{}{
+					"id":                "user-2",
+					"displayName":       "User 2",
+					"userPrincipalName": "user2@example.com",
+					"groups":            []interface{}{},
+					"directoryRoles":    []interface{}{},
+				},
+			}},
+		},
+		"UserNotFound": {
+			reason: "No results should be returned if no user exists",
+			in: &v1beta1.Input{
+				QueryType: "UserMemberOf",
+				Users:     []*string{strPtr("missing@example.com")},
+			},
+			want: want{results: map[string]interface{}{}},
+		},
+		"MaxResults": {
+			reason: "The memberships of each user should be truncated to maxResults with a warning",
+			in: &v1beta1.Input{
+				QueryType:  "UserMemberOf",
+				Users:      []*string{strPtr("user1@example.com")},
+				Transitive: boolPtr(true),
+				MaxResults: intPtr(1),
+			},
+			want: want{
+				results: map[string]interface{}{
+					"user1@example.com": user1([]interface{}{developers}, []interface{}{}),
+				},
+				warnings: []string{"UserMemberOf results for user user1@example.com were truncated to maxResults (1)"},
+			},
+		},
+		"MembershipsNotReadable": {
+			reason: "An error reading the memberships of a user should fail the query",
+			in: &v1beta1.Input{
+				QueryType: "UserMemberOf",
+				Users:     []*string{strPtr("hidden@example.com")},
+			},
+			want: want{err: "failed to get memberships for user hidden@example.com: Resource '/v1.0/users/user-3/memberOf' does not exist."},
+		},
+		"LookupError": {
+			reason: "An error looking up a user should fail the query",
+			in: &v1beta1.Input{
+				QueryType: "UserMemberOf",
+				Users:     []*string{strPtr("broken@example.com")},
+			},
+			want: want{err: "failed to find user broken@example.com: Resource '/v1.0/users?$filter=userPrincipalName eq 'broken@example.com'' does not exist."},
+		},
+		"NoUsers": {
+			reason: "A query without users should fail",
+			in:     &v1beta1.Input{QueryType: "UserMemberOf"},
+			want:   want{err: "no users provided"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx, warnings := withQueryWarnings(context.Background())
+			g := &GraphQuery{}
+			results, err := g.getUserMemberOf(ctx, client, tc.in)
+
+			if diff := cmp.Diff(tc.want.err, errString(err)); diff != "" {
+				t.Fatalf("%s\ngetUserMemberOf(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+			if tc.want.err != "" {
+				return
+			}
+			if diff := cmp.Diff(tc.want.results, results); diff != "" {
+				t.Errorf("%s\ngetUserMemberOf(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.warnings, warnings.list(), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("%s\ngetUserMemberOf(...): -want warnings, +got warnings:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestCheckMembership(t *testing.T) {
+	client := newFakeGraphClient(t, map[string]string{
+		"/v1.0/users?$filter=userPrincipalName eq 'user1@example.com'":                    `{"value": [{"id": "user-1"}]}`,
+		"/v1.0/users?$filter=userPrincipalName eq 'user2@example.com'":                    `{"value": [{"id": "user-2"}]}`,
+		"/v1.0/groups?$filter=displayName eq 'Developers'":                                `{"value": [{"id": "group-1"}]}`,
+		"/v1.0/groups?$filter=displayName eq 'Platform'":                                  `{"value": [{"id": "group-9"}]}`,
+		"/v1.0/groups?$filter=displayName eq 'Missing'":                                   `{"value": []}`,
+		"/v1.0/groups/22222222-2222-2222-2222-222222222222":                               `{"id": "22222222-2222-2222-2222-222222222222"}`,
+		"/v1.0/users/user-1/checkMemberGroups":                                            `{"value": ["group-1"]}`,
+		"/v1.0/groups/group-9/checkMemberGroups":                                          `{"value": ["group-1"]}`,
+		"/v1.0/servicePrincipals?$filter=appId eq '33333333-3333-3333-3333-333333333333'": `{"value": []}`,
+	})
+
+	type want struct {
+		results  interface{}
+		warnings []string
+		err      string
+	}
+
+	cases := map[string]struct {
+		reason string
+		in     *v1beta1.Input
+		want   want
+	}{
+		"UserPrincipal": {
+			reason: "Groups looked up by name or ID should report the membership of a user, and missing groups should warn",
+			in: &v1beta1.Input{
+				QueryType: "CheckMembership",
+				Principal: strPtr("user1@example.com"),
+				Groups:    []*string{strPtr("Developers"), strPtr("22222222-2222-2222-2222-222222222222"), strPtr("Missing")},
+			},
+			want: want{
+				results: map[string]interface{}{
+					"Developers":                           true,
+					"22222222-2222-2222-2222-222222222222": false,
+					"Missing":                              false,
+				},
+				warnings: []string{"CheckMembership group Missing was not found"},
+			},
+		},
+		"GroupPrincipal": {
+			reason: "The membership of a group should be checked against the groups endpoint",
+			in: &v1beta1.Input{
+				QueryType:     "CheckMembership",
+				Principal:     strPtr("Platform"),
+				PrincipalType: "Group",
+				Groups:        []*string{strPtr("Developers")},
+			},
+			want: want{results: map[string]interface{}{"Developers": true}},
+		},
+		"NoGroupsFound": {
+			reason: "A principal should be reported as not a member of groups that do not exist",
+			in: &v1beta1.Input{
+				QueryType: "CheckMembership",
+				Principal: strPtr("user1@example.com"),
+				Groups:    []*string{strPtr("Missing")},
+			},
+			want: want{
+				results:  map[string]interface{}{"Missing": false},
+				warnings: []string{"CheckMembership group Missing was not found"},
+			},
+		},
+		"PrincipalNotFound": {
+			reason: "A principal that does not exist should fail the query",
+			in: &v1beta1.Input{
+				QueryType: "CheckMembership",
+				Principal: strPtr("33333333-3333-3333-3333-333333333333"),
+				Groups:    []*string{strPtr("Developers")},
+			},
+			want: want{err: "principal not found: 33333333-3333-3333-3333-333333333333"},
+		},
+		"GroupLookupError": {
+			reason: "An error looking up a group should fail the query",
+			in: &v1beta1.Input{
+				QueryType: "CheckMembership",
+				Principal: strPtr("user1@example.com"),
+				Groups:    []*string{strPtr("Broken")},
+			},
+			want: want{err: "failed to find group Broken: Resource '/v1.0/groups?$filter=displayName eq 'Broken'' does not exist."},
+		},
+		"CheckError": {
+			reason: "An error checking the membership of the principal should fail the query",
+			in: &v1beta1.Input{
+				QueryType: "CheckMembership",
+				Principal: strPtr("user2@example.com"),
+				Groups:    []*string{strPtr("Developers")},
+			},
+			want: want{err: "failed to check group membership of user2@example.com: Resource '/v1.0/users/user-2/checkMemberGroups' does not exist."},
+		},
+		"NoPrincipal": {
+			reason: "A query without a principal should fail",
+			in: &v1beta1.Input{
+				QueryType: "CheckMembership",
+				Groups:    []*string{strPtr("Developers")},
+			},
+			want: want{err: "no principal provided"},
+		},
+		"NoGroups": {
+			reason: "A query without groups should fail",
+			in: &v1beta1.Input{
+				QueryType: "CheckMembership",
+				Principal: strPtr("user1@example.com"),
+			},
+			want: want{err: "no group names provided"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx, warnings := withQueryWarnings(context.Background())
+			g := &GraphQuery{}
+			results, err := g.checkMembership(ctx, client, tc.in)
+
+			if diff := cmp.Diff(tc.want.err, errString(err)); diff != "" {
+				t.Fatalf("%s\ncheckMembership(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+			if tc.want.err != "" {
+				return
+			}
+			if diff := cmp.Diff(tc.want.results, results); diff != "" {
+				t.Errorf("%s\ncheckMembership(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.warnings, warnings.list(), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("%s\ncheckMembership(...): -want warnings, +got warnings:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetDirectoryRoleAssignments(t *testing.T) {
+	client := newFakeGraphClient(t, map[string]string{
+		"/v1.0/servicePrincipals?$filter=appId eq '11111111-1111-1111-1111-111111111111'": `{"value": [{"id": "sp-1"}]}`,
+		"/v1.0/roleManagement/directory/roleAssignments?$filter=principalId eq 'sp-1'": `{
+			"value": [{
+				"id": "assignment-1",
+				"principalId": "sp-1",
+				"roleDefinitionId": "role-1",
+				"directoryScopeId": "/",
+				"roleDefinition": {"id": "role-1", "displayName": "Application Administrator", "templateId": "role-1", "isBuiltIn": true}
+			}]
+		}`,
+		"/v1.0/roleManagement/directory/roleDefinitions?$filter=displayName eq 'Global Reader'": `{
+			"value": [{"id": "role-2", "displayName": "Global Reader", "templateId": "role-2", "isBuiltIn": true}]
+		}`,
+		"/v1.0/roleManagement/directory/roleAssignments?$filter=roleDefinitionId eq 'role-2'": `{
+			"value": [{
+				"id": "assignment-2",
+				"principalId": "group-1",
+				"roleDefinitionId": "role-2",
+				"directoryScopeId": "/",
+				"principal": {"@odata.type": "#microsoft.graph.group", "id": "group-1", "displayName": "Readers"}
+			}]
+		}`,
+		"/v1.0/users?$filter=userPrincipalName eq 'user1@example.com'":                    `{"value": [{"id": "user-1"}]}`,
+		"/v1.0/roleManagement/directory/roleAssignments?$filter=principalId eq 'user-1'":  `{"value": []}`,
+		"/v1.0/servicePrincipals?$filter=appId eq '22222222-2222-2222-2222-222222222222'": `{"value": []}`,
+		"/v1.0/roleManagement/directory/roleDefinitions?$filter=displayName eq 'Missing'": `{"value": []}`,
+		"/v1.0/roleManagement/directory/roleDefinitions?$filter=displayName eq 'Hidden'": `{
+			"value": [{"id": "role-3", "displayName": "Hidden", "templateId": "role-3", "isBuiltIn": false}]
+		}`,
+	})
+
+	type want struct {
+		results interface{}
+		err     string
+	}
+
+	cases := map[string]struct {
+		reason string
+		in     *v1beta1.Input
+		want   want
+	}{
+		"RolesOfPrincipal": {
+			reason: "The roles held by a service principal should be returned with their role definitions",
+			in: &v1beta1.Input{
+				QueryType: "DirectoryRoleAssignments",
+				Principal: strPtr("11111111-1111-1111-1111-111111111111"),
+			},
+			want: want{results: []interface{}{
+				map[string]interface{}{
+					"id":               "assignment-1",
+					"principalId":      "sp-1",
+					"roleDefinitionId": "role-1",
+					"directoryScopeId": "/",
+					"roleName":         "Application Administrator",
+					"roleTemplateId":   "role-1",
+					"isBuiltIn":        true,
+				},
+			}},
+		},
+		"HoldersOfRole": {
+			reason: "The principals holding a named role should be returned with their assignments",
+			in: &v1beta1.Input{
+				QueryType: "DirectoryRoleAssignments",
+				Role:      strPtr("Global Reader"),
+			},
+			want: want{results: []interface{}{
+				map[string]interface{}{
+					"id":               "assignment-2",
+					"principalId":      "group-1",
+					"roleDefinitionId": "role-2",
+					"directoryScopeId": "/",
+					"roleName":         "Global Reader",
+					"roleTemplateId":   "role-2",
+					"isBuiltIn":        true,
+					"principal": map[string]interface{}{
+						"id":          "group-1",
+						"type":        "group",
+						"displayName": "Readers",
+					},
+				},
+			}},
+		},
+		"PrincipalAndRole": {
+			reason: "A principal and a role should not be looked up at once",
+			in: &v1beta1.Input{
+				QueryType: "DirectoryRoleAssignments",
+				Principal: strPtr("11111111-1111-1111-1111-111111111111"),
+				Role:      strPtr("Global Reader"),
+			},
+			want: want{err: "only one of principal and role can be provided"},
+		},
+		"NoAssignments": {
+			reason: "A principal holding no roles should return an empty list",
+			in: &v1beta1.Input{
+				QueryType: "DirectoryRoleAssignments",
+				Principal: strPtr("user1@example.com"),
+			},
+			want: want{results: []interface{}{}},
+		},
+		"PrincipalNotFound": {
+			reason: "A principal that does not exist should fail the query",
+			in: &v1beta1.Input{
+				QueryType: "DirectoryRoleAssignments",
+				Principal: strPtr("22222222-2222-2222-2222-222222222222"),
+			},
+			want: want{err: "principal not found: 22222222-2222-2222-2222-222222222222"},
+		},
+		"RoleNotFound": {
+			reason: "A role that does not exist should fail the query",
+			in: &v1beta1.Input{
+				QueryType: "DirectoryRoleAssignments",
+				Role:      strPtr("Missing"),
+			},
+			want: want{err: "role not found: Missing"},
+		},
+		"AssignmentsNotReadable": {
+			reason: "An error reading the assignments of a role should fail the query",
+			in: &v1beta1.Input{
+				QueryType: "DirectoryRoleAssignments",
+				Role:      strPtr("Hidden"),
+			},
+			want: want{err: "failed to get assignments of role Hidden: Resource '/v1.0/roleManagement/directory/roleAssignments?$filter=roleDefinitionId eq 'role-3'' does not exist."},
+		},
+		"NoPrincipalOrRole": {
+			reason: "A query without a principal or a role should fail",
+			in:     &v1beta1.Input{QueryType: "DirectoryRoleAssignments"},
+			want:   want{err: "no principal or role provided"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			g := &GraphQuery{}
+			results, err := g.getDirectoryRoleAssignments(context.Background(), client, tc.in)
+
+			if diff := cmp.Diff(tc.want.results, results); diff != "" {
+				t.Errorf("%s\ngetDirectoryRoleAssignments(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, errString(err)); diff != "" {
+				t.Errorf("%s\ngetDirectoryRoleAssignments(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetAppRoleAssignments(t *testing.T) {
+	const (
+		graphAppID  = "00000003-0000-0000-c000-000000000000"
+		graphID     = "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa"
+		workloadID  = "bbbbbbbb-bbbb-bbbb-bbbb-bbbbbbbbbbbb"
+		unknownID   = "cccccccc-cccc-cccc-cccc-cccccccccccc"
+		hiddenID    = "dddddddd-dddd-dddd-dddd-dddddddddddd"
+		userReadAll = "df021288-bdef-4463-88db-98f22de89214"
+		defaultRole = "00000000-0000-0000-0000-000000000000"
+	)
+
+	graph := `{"id": "` + graphID + `", "appId": "` + graphAppID + `", "displayName": "Microsoft Graph",
+		"appRoles": [{"id": "` + userReadAll + `", "value": "User.Read.All", "displayName": "Read all users' full profiles"}]}`
+	assignment := func(id, principalID, principalName, resourceID, resourceName, appRoleID string) string {
+		return `{"id": "` + id + `", "principalId": "` + principalID + `", "principalDisplayName": "` + principalName +
+			`", "principalType": "ServicePrincipal", "resourceId": "` + resourceID + `", "resourceDisplayName": "` + resourceName +
+			`", "appRoleId": "` + appRoleID + `"}`
+	}
+
+	client := newFakeGraphClient(t, map[string]string{
+		"/v1.0/servicePrincipals?$filter=appId eq '" + graphAppID + "'":                                  `{"value": [` + graph + `]}`,
+		"/v1.0/servicePrincipals/" + graphID:                                                             graph,
+		"/v1.0/servicePrincipals?$filter=displayName eq 'my-workload'":                                   `{"value": [{"id": "` + workloadID + `"}]}`,
+		"/v1.0/servicePrincipals/" + workloadID + "/appRoleAssignments":                                  `{"value": [` + assignment("a-1", workloadID, "my-workload", graphID, "Microsoft Graph", userReadAll) + `, ` + assignment("a-2", workloadID, "my-workload", unknownID, "Unknown API", userReadAll) + `]}`,
+		"/v1.0/servicePrincipals/" + workloadID + "/appRoleAssignments?$filter=resourceId eq " + graphID: `{"value": [` + assignment("a-1", workloadID, "my-workload", graphID, "Microsoft Graph", userReadAll) + `]}`,
+		"/v1.0/servicePrincipals/" + graphID + "/appRoleAssignedTo":                                      `{"value": [` + assignment("a-1", workloadID, "my-workload", graphID, "Microsoft Graph", userReadAll) + `, ` + assignment("a-3", workloadID, "my-workload", graphID, "Microsoft Graph", defaultRole) + `]}`,
+		"/v1.0/servicePrincipals?$filter=displayName eq 'missing'":                                       `{"value": []}`,
+		"/v1.0/servicePrincipals?$filter=displayName eq 'Missing API'":                                   `{"value": []}`,
+		"/v1.0/servicePrincipals?$filter=displayName eq 'Hidden API'":                                    `{"value": [{"id": "` + hiddenID + `", "displayName": "Hidden API"}]}`,
+	})
+
+	type want struct {
+		assignments []string
+		warnings    []string
+		err         string
+	}
+
+	cases := map[string]struct {
+		reason string
+		in     *v1beta1.Input
+		want   want
+	}{
+		"RolesOfServicePrincipal": {
+			reason: "App roles granted to a service principal should be resolved from the app roles of each resource",
+			in: &v1beta1.Input{
+				QueryType:         "AppRoleAssignments",
+				ServicePrincipals: []*string{strPtr("my-workload")},
+			},
+			want: want{
+				assignments: []string{
+					"a-1: my-workload has User.Read.All on Microsoft Graph",
+					"a-2: my-workload has <nil> on Unknown API",
+				},
+				warnings: []string{"AppRoleAssignments could not read the app roles of resource " + unknownID},
+			},
+		},
+		"RolesOfServicePrincipalOnResource": {
+			reason: "Only the app roles granted on the resource should be returned if a resource is named",
+			in: &v1beta1.Input{
+				QueryType:         "AppRoleAssignments",
+				ServicePrincipals: []*string{strPtr("my-workload")},
+				Resource:          strPtr(graphAppID),
+			},
+			want: want{
+				assignments: []string{"a-1: my-workload has User.Read.All on Microsoft Graph"},
+			},
+		},
+		"RolesOnResource": {
+			reason: "App roles granted on a resource should be returned if only a resource is named",
+			in: &v1beta1.Input{
+				QueryType: "AppRoleAssignments",
+				Resource:  strPtr(graphAppID),
+			},
+			want: want{
+				assignments: []string{
+					"a-1: my-workload has User.Read.All on Microsoft Graph",
+					"a-3: my-workload has <nil> on Microsoft Graph",
+				},
+			},
+		},
+		"ServicePrincipalNotFound": {
+			reason: "No app roles should be returned for a service principal that does not exist",
+			in: &v1beta1.Input{
+				QueryType:         "AppRoleAssignments",
+				ServicePrincipals: []*string{strPtr("missing")},
+			},
+			want: want{},
+		},
+		"ResourceNotFound": {
+			reason: "A resource that does not exist should fail the query",
+			in: &v1beta1.Input{
+				QueryType:         "AppRoleAssignments",
+				ServicePrincipals: []*string{strPtr("my-workload")},
+				Resource:          strPtr("Missing API"),
+			},
+			want: want{err: "resource not found: Missing API"},
+		},
+		"LookupError": {
+			reason: "An error looking up a service principal should fail the query",
+			in: &v1beta1.Input{
+				QueryType:         "AppRoleAssignments",
+				ServicePrincipals: []*string{strPtr("broken")},
+			},
+			want: want{err: "failed to find service principal broken: Resource '/v1.0/servicePrincipals?$filter=displayName eq 'broken'' does not exist."},
+		},
+		"AssignmentsNotReadable": {
+			reason: "An error reading the app roles granted on a resource should fail the query",
+			in: &v1beta1.Input{
+				QueryType: "AppRoleAssignments",
+				Resource:  strPtr("Hidden API"),
+			},
+			want: want{err: "failed to get app role assignments on Hidden API: Resource '/v1.0/servicePrincipals/" + hiddenID + "/appRoleAssignedTo' does not exist."},
+		},
+		"NoServicePrincipalsOrResource": {
+			reason: "A query without service principals or a resource should fail",
+			in:     &v1beta1.Input{QueryType: "AppRoleAssignments"},
+			want:   want{err: "no service principal names or resource provided"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx, warnings := withQueryWarnings(context.Background())
+			g := &GraphQuery{}
+			results, err := g.getAppRoleAssignments(ctx, client, tc.in)
+
+			if diff := cmp.Diff(tc.want.err, errString(err)); diff != "" {
+				t.Fatalf("%s\ngetAppRoleAssignments(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+			if tc.want.err != "" {
+				return
+			}
+
+			var got []string
+			for _, result := range results.([]interface{}) {
+				a := result.(map[string]interface{})
+				got = append(got, fmt.Sprintf("%s: %s has %v on %s", a["id"], a["principalDisplayName"], a["appRoleValue"], a["resourceDisplayName"]))
+			}
+			if diff := cmp.Diff(tc.want.assignments, got); diff != "" {
+				t.Errorf("%s\ngetAppRoleAssignments(...): -want assignments, +got assignments:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.warnings, warnings.list(), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("%s\ngetAppRoleAssignments(...): -want warnings, +got warnings:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetOAuth2PermissionGrants(t *testing.T) {
+	client := newFakeGraphClient(t, map[string]string{
+		"/v1.0/servicePrincipals?$filter=displayName eq 'my-web-app'": `{"value": [{"id": "sp-1"}]}`,
+		"/v1.0/servicePrincipals/sp-1/oauth2PermissionGrants": `{"value": [
+			{"id": "grant-1", "clientId": "sp-1", "resourceId": "graph-sp", "consentType": "AllPrincipals", "scope": " openid  profile User.Read "},
+			{"id": "grant-2", "clientId": "sp-1", "resourceId": "api-sp", "consentType": "Principal", "principalId": "user-1", "scope": ""}
+		]}`,
+		"/v1.0/servicePrincipals?$filter=displayName eq 'idle-app'":   `{"value": [{"id": "sp-2"}]}`,
+		"/v1.0/servicePrincipals/sp-2/oauth2PermissionGrants":         `{"value": []}`,
+		"/v1.0/servicePrincipals?$filter=displayName eq 'hidden-app'": `{"value": [{"id": "sp-3"}]}`,
+		"/v1.0/servicePrincipals?$filter=displayName eq 'missing'":    `{"value": []}`,
+	})
+
+	grant1 := map[string]interface{}{
+		"id":          "grant-1",
+		"clientId":    "sp-1",
+		"resourceId":  "graph-sp",
+		"principalId": nil,
+		"consentType": "AllPrincipals",
+		"scope":       " openid  profile User.Read ",
+		"scopes":      []interface{}{"openid", "profile", "User.Read"},
+	}
+	grant2 := map[string]interface{}{
+		"id":          "grant-2",
+		"clientId":    "sp-1",
+		"resourceId":  "api-sp",
+		"principalId": "user-1",
+		"consentType": "Principal",
+		"scope":       "",
+		"scopes":      []interface{}{},
+	}
+
+	type want struct {
+		results  interface{}
+		warnings []string
+		err      string
+	}
+
+	cases := map[string]struct {
+		reason string
+		in     *v1beta1.Input
+		want   want
+	}{
+		"Grants": {
+			reason: "The delegated permission grants of a service principal should be returned with their scopes split",
+			in: &v1beta1.Input{
+				QueryType:         "OAuth2PermissionGrants",
+				ServicePrincipals: []*string{strPtr("my-web-app")},
+			},
+			want: want{results: []interface{}{grant1, grant2}},
+		},
+		"MaxResults": {
+			reason: "The grants should be truncated to maxResults with a warning",
+			in: &v1beta1.Input{
+				QueryType:         "OAuth2PermissionGrants",
+				ServicePrincipals: []*string{strPtr("my-web-app")},
+				MaxResults:        intPtr(1),
+			},
+			want: want{
+				results:  []interface{}{grant1},
+				warnings: []string{"OAuth2PermissionGrants results were truncated to maxResults (1)"},
+			},
+		},
+		"NoGrants": {
+			reason: "No grants should be returned for a service principal without any",
+			in: &v1beta1.Input{
+				QueryType:         "OAuth2PermissionGrants",
+				ServicePrincipals: []*string{strPtr("idle-app")},
+			},
+			want: want{results: []interface{}(nil)},
+		},
+		"ServicePrincipalNotFound": {
+			reason: "No grants should be returned for a service principal that does not exist",
+			in: &v1beta1.Input{
+				QueryType:         "OAuth2PermissionGrants",
+				ServicePrincipals: []*string{strPtr("missing")},
+			},
+			want: want{results: []interface{}(nil)},
+		},
+		"LookupError": {
+			reason: "An error looking up a service principal should fail the query",
+			in: &v1beta1.Input{
+				QueryType:         "OAuth2PermissionGrants",
+				ServicePrincipals: []*string{strPtr("broken")},
+			},
+			want: want{err: "failed to find service principal broken: Resource '/v1.0/servicePrincipals?$filter=displayName eq 'broken'' does not exist."},
+		},
+		"GrantsNotReadable": {
+			reason: "An error reading the grants of a service principal should fail the query",
+			in: &v1beta1.Input{
+				QueryType:         "OAuth2PermissionGrants",
+				ServicePrincipals: []*string{strPtr("hidden-app")},
+			},
+			want: want{err: "failed to get delegated permission grants of hidden-app: Resource '/v1.0/servicePrincipals/sp-3/oauth2PermissionGrants' does not exist."},
+		},
+		"NoServicePrincipals": {
+			reason: "A query without service principals should fail",
+			in:     &v1beta1.Input{QueryType: "OAuth2PermissionGrants"},
+			want:   want{err: "no service principal names provided"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx, warnings := withQueryWarnings(context.Background())
+			g := &GraphQuery{}
+			results, err := g.getOAuth2PermissionGrants(ctx, client, tc.in)
+
+			if diff := cmp.Diff(tc.want.err, errString(err)); diff != "" {
+				t.Fatalf("%s\ngetOAuth2PermissionGrants(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+			if tc.want.err != "" {
+				return
+			}
+			if diff := cmp.Diff(tc.want.results, results); diff != "" {
+				t.Errorf("%s\ngetOAuth2PermissionGrants(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.warnings, warnings.list(), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("%s\ngetOAuth2PermissionGrants(...): -want warnings, +got warnings:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
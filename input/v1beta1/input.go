@@ -20,10 +20,12 @@ type Input struct {
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
 	// QueryType defines the type of Microsoft Graph API query to perform
-	// Supported values: UserValidation, GroupMembership, GroupObjectIDs, ServicePrincipalDetails
+	// Supported values: UserValidation, GroupMembership, GroupObjectIDs, GroupOwners,
+	// ServicePrincipalDetails, ApplicationDetails, UserMemberOf, CheckMembership,
+	// DirectoryRoleAssignments, AppRoleAssignments, OAuth2PermissionGrants, Custom
 	QueryType string `json:"queryType"`
 
-	// Users is a list of userPrincipalName (email IDs) for user validation
+	// Users is a list of userPrincipalName (email IDs) for user validation and user membership queries
 	// +optional
 	Users []*string `json:"users,omitempty"`
 
@@ -32,7 +34,7 @@ type Input struct {
 	// +optional
 	UsersRef *string `json:"usersRef,omitempty"`
 
-	// Groups is a list of group names for group object ID queries
+	// Groups is a list of group names for group object ID, group owner and membership check queries
 	// +optional
 	Groups []*string `json:"groups,omitempty"`
 
@@ -50,7 +52,28 @@ type Input struct {
 	// +optional
 	GroupRef *string `json:"groupRef,omitempty"`
 
-	// ServicePrincipals is a list of service principal names
+	// Transitive makes group membership queries return the members of nested
+	// groups too, and user membership queries return the groups and directory
+	// roles users belong to through nested groups
+	// Default is false
+	// +optional
+	Transitive *bool `json:"transitive,omitempty"`
+
+	// ResolveNesting makes transitive group membership queries also return the
+	// depth and parent group each member came through. This lists the direct
+	// members of every nested group, at the cost of additional requests per group
+	// Default is false
+	// +optional
+	ResolveNesting *bool `json:"resolveNesting,omitempty"`
+
+	// MaxMembers is the maximum number of members returned by group membership queries
+	// Defaults to 10000
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxMembers *int `json:"maxMembers,omitempty"`
+
+	// ServicePrincipals is a list of service principal names for service principal
+	// detail, app role assignment and delegated permission grant queries
 	// +optional
 	ServicePrincipals []*string `json:"servicePrincipals,omitempty"`
 
@@ -59,6 +82,136 @@ type Input struct {
 	// +optional
 	ServicePrincipalsRef *string `json:"servicePrincipalsRef,omitempty"`
 
+	// Principal is the user principal name of a user, or the app ID of a service
+	// principal, for membership check and directory role assignment queries
+	// +optional
+	Principal *string `json:"principal,omitempty"`
+
+	// PrincipalRef is a reference to retrieve the principal (e.g., from status or context)
+	// Overrides Principal field if used
+	// +optional
+	PrincipalRef *string `json:"principalRef,omitempty"`
+
+	// PrincipalType is the type of the principal: User, found by user principal
+	// name or ID, Group, found by display name or ID, or ServicePrincipal, found
+	// by app ID. Defaults to ServicePrincipal if the principal is a GUID, and to
+	// User otherwise
+	// +kubebuilder:validation:Enum=User;Group;ServicePrincipal
+	// +optional
+	PrincipalType string `json:"principalType,omitempty"`
+
+	// Role is the display name or ID of a directory role, for directory role
+	// assignment queries listing the principals holding it
+	// +optional
+	Role *string `json:"role,omitempty"`
+
+	// RoleRef is a reference to retrieve the role (e.g., from status or context)
+	// Overrides Role field if used
+	// +optional
+	RoleRef *string `json:"roleRef,omitempty"`
+
+	// Resource is the display name or app ID of the resource service principal, such
+	// as an API, for app role assignment queries
+	// +optional
+	Resource *string `json:"resource,omitempty"`
+
+	// ResourceRef is a reference to retrieve the resource (e.g., from status or context)
+	// Overrides Resource field if used
+	// +optional
+	ResourceRef *string `json:"resourceRef,omitempty"`
+
+	// Applications is a list of application display names or app IDs
+	// +optional
+	Applications []*string `json:"applications,omitempty"`
+
+	// ApplicationsRef is a reference to retrieve the application names (e.g., from status or context)
+	// Overrides Applications field if used
+	// +optional
+	ApplicationsRef *string `json:"applicationsRef,omitempty"`
+
+	// LookupBy is the property the users, groups, service principals or applications
+	// are looked up by, including names resolved from references: displayName,
+	// userPrincipalName, appId or id. Defaults to userPrincipalName for users and
+	// displayName otherwise
+	// +kubebuilder:validation:Enum=displayName;userPrincipalName;appId;id
+	// +optional
+	LookupBy string `json:"lookupBy,omitempty"`
+
+	// Path is the Microsoft Graph path read by Custom queries, relative to the
+	// v1.0 endpoint, e.g. /groups. Only GET requests are sent, and the path must
+	// start with one of the path prefixes the function allows
+	// +optional
+	Path *string `json:"path,omitempty"`
+
+	// Filter is the OData $filter of Custom queries, e.g. startsWith(displayName,'platform-')
+	// +optional
+	Filter *string `json:"filter,omitempty"`
+
+	// Select is the list of properties returned by UserValidation, GroupObjectIDs,
+	// ServicePrincipalDetails and Custom queries ($select). The id, and the
+	// properties names are looked up by, are always returned for users, groups
+	// and service principals, which otherwise default to id, displayName,
+	// userPrincipalName and mail for users, id, displayName and description for
+	// groups, and id, appId, displayName and description for service principals
+	// +optional
+	Select []string `json:"select,omitempty"`
+
+	// Expand is the list of relationships expanded by Custom queries ($expand)
+	// +optional
+	Expand []string `json:"expand,omitempty"`
+
+	// OrderBy is the list of properties Custom queries are sorted by ($orderby),
+	// e.g. displayName desc
+	// +optional
+	OrderBy []string `json:"orderBy,omitempty"`
+
+	// Top is the number of results returned by Custom queries ($top). Results
+	// are not paged if set
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Top *int `json:"top,omitempty"`
+
+	// MaxResults is the maximum number of results returned by UserValidation,
+	// GroupObjectIDs, ServicePrincipalDetails, ApplicationDetails,
+	// DirectoryRoleAssignments, AppRoleAssignments, OAuth2PermissionGrants and
+	// Custom queries, and of memberships returned per user by UserMemberOf queries
+	// Defaults to 1000
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxResults *int `json:"maxResults,omitempty"`
+
+	// OnMissing controls what happens when a requested user, group, service
+	// principal or application is not found: Fail stops the function with a ValidationFailed
+	// condition, Warn returns a warning, and Ignore returns the results found
+	// Default is Ignore
+	// +kubebuilder:validation:Enum=Fail;Warn;Ignore
+	// +optional
+	OnMissing string `json:"onMissing,omitempty"`
+
+	// OutputFormat controls the shape of the results stored in the target: List
+	// stores the results as returned, MapByName keys them by the name they were
+	// looked up by, MapByID keys them by object ID, and IDsOnly stores a list of
+	// their object IDs. MapByName is supported by UserValidation, GroupObjectIDs,
+	// ServicePrincipalDetails and ApplicationDetails queries
+	// Default is List
+	// +kubebuilder:validation:Enum=List;MapByName;MapByID;IDsOnly
+	// +optional
+	OutputFormat string `json:"outputFormat,omitempty"`
+
+	// SortBy is the property results are sorted by, so that they are stored in
+	// the same order whatever order Microsoft Graph returns them in. Results
+	// sharing a value are sorted by id, and results without the property come last
+	// Custom queries with orderBy keep their order unless sortBy is set
+	// Default is id
+	// +optional
+	SortBy *string `json:"sortBy,omitempty"`
+
+	// Transform is a CEL expression that reshapes the query results, referred
+	// to as results, before they are stored in the target, e.g.
+	// results.map(u, u.id)
+	// +optional
+	Transform *string `json:"transform,omitempty"`
+
 	// Target where to store the Query Result
 	Target string `json:"target"`
 
@@ -66,4 +219,10 @@ type Input struct {
 	// Default is false to ensure continuous reconciliation
 	// +optional
 	SkipQueryWhenTargetHasData *bool `json:"skipQueryWhenTargetHasData,omitempty"`
+
+	// CacheTTL is how long the query results are cached in the function and reused
+	// for identical queries against the same tenant, e.g. "5m"
+	// Results are not cached if unset
+	// +optional
+	CacheTTL *metav1.Duration `json:"cacheTTL,omitempty"`
 }
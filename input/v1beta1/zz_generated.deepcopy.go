@@ -5,6 +5,7 @@
 package v1beta1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -55,6 +56,21 @@ func (in *Input) DeepCopyInto(out *Input) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.Transitive != nil {
+		in, out := &in.Transitive, &out.Transitive
+		*out = new(bool)
+		**out = **in
+	}
+	if in.ResolveNesting != nil {
+		in, out := &in.ResolveNesting, &out.ResolveNesting
+		*out = new(bool)
+		**out = **in
+	}
+	if in.MaxMembers != nil {
+		in, out := &in.MaxMembers, &out.MaxMembers
+		*out = new(int)
+		**out = **in
+	}
 	if in.ServicePrincipals != nil {
 		in, out := &in.ServicePrincipals, &out.ServicePrincipals
 		*out = make([]*string, len(*in))
@@ -71,11 +87,107 @@ func (in *Input) DeepCopyInto(out *Input) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.Principal != nil {
+		in, out := &in.Principal, &out.Principal
+		*out = new(string)
+		**out = **in
+	}
+	if in.PrincipalRef != nil {
+		in, out := &in.PrincipalRef, &out.PrincipalRef
+		*out = new(string)
+		**out = **in
+	}
+	if in.Role != nil {
+		in, out := &in.Role, &out.Role
+		*out = new(string)
+		**out = **in
+	}
+	if in.RoleRef != nil {
+		in, out := &in.RoleRef, &out.RoleRef
+		*out = new(string)
+		**out = **in
+	}
+	if in.Resource != nil {
+		in, out := &in.Resource, &out.Resource
+		*out = new(string)
+		**out = **in
+	}
+	if in.ResourceRef != nil {
+		in, out := &in.ResourceRef, &out.ResourceRef
+		*out = new(string)
+		**out = **in
+	}
+	if in.Applications != nil {
+		in, out := &in.Applications, &out.Applications
+		*out = make([]*string, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(string)
+				**out = **in
+			}
+		}
+	}
+	if in.ApplicationsRef != nil {
+		in, out := &in.ApplicationsRef, &out.ApplicationsRef
+		*out = new(string)
+		**out = **in
+	}
+	if in.Path != nil {
+		in, out := &in.Path, &out.Path
+		*out = new(string)
+		**out = **in
+	}
+	if in.Filter != nil {
+		in, out := &in.Filter, &out.Filter
+		*out = new(string)
+		**out = **in
+	}
+	if in.Select != nil {
+		in, out := &in.Select, &out.Select
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Expand != nil {
+		in, out := &in.Expand, &out.Expand
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.OrderBy != nil {
+		in, out := &in.OrderBy, &out.OrderBy
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Top != nil {
+		in, out := &in.Top, &out.Top
+		*out = new(int)
+		**out = **in
+	}
+	if in.MaxResults != nil {
+		in, out := &in.MaxResults, &out.MaxResults
+		*out = new(int)
+		**out = **in
+	}
+	if in.SortBy != nil {
+		in, out := &in.SortBy, &out.SortBy
+		*out = new(string)
+		**out = **in
+	}
+	if in.Transform != nil {
+		in, out := &in.Transform, &out.Transform
+		*out = new(string)
+		**out = **in
+	}
 	if in.SkipQueryWhenTargetHasData != nil {
 		in, out := &in.SkipQueryWhenTargetHasData, &out.SkipQueryWhenTargetHasData
 		*out = new(bool)
 		**out = **in
 	}
+	if in.CacheTTL != nil {
+		in, out := &in.CacheTTL, &out.CacheTTL
+		*out = new(v1.Duration)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Input.
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	abstractions "github.com/microsoft/kiota-abstractions-go"
+	"github.com/microsoft/kiota-abstractions-go/serialization"
+	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
+	"github.com/upbound/function-msgraph/input/v1beta1"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+)
+
+const (
+	// lookupByDisplayName looks up objects by their displayName
+	lookupByDisplayName = "displayName"
+	// lookupByUserPrincipalName looks up users by their userPrincipalName
+	lookupByUserPrincipalName = "userPrincipalName"
+	// lookupByAppID looks up service principals and applications by their appId
+	lookupByAppID = "appId"
+	// lookupByID looks up objects by their object ID
+	lookupByID = "id"
+)
+
+// lookupProperties lists, for each query type, the properties its names can be
+// looked up by. The first property is the default.
+var lookupProperties = map[string][]string{
+	"UserValidation":          {lookupByUserPrincipalName, lookupByID},
+	"UserMemberOf":            {lookupByUserPrincipalName, lookupByID},
+	"GroupMembership":         {lookupByDisplayName, lookupByID},
+	"GroupObjectIDs":          {lookupByDisplayName, lookupByID},
+	"GroupOwners":             {lookupByDisplayName, lookupByID},
+	"CheckMembership":         {lookupByDisplayName, lookupByID},
+	"ServicePrincipalDetails": {lookupByDisplayName, lookupByAppID, lookupByID},
+	"AppRoleAssignments":      {lookupByDisplayName, lookupByAppID, lookupByID},
+	"OAuth2PermissionGrants":  {lookupByDisplayName, lookupByAppID, lookupByID},
+	"ApplicationDetails":      {lookupByDisplayName, lookupByAppID, lookupByID},
+}
+
+// isValidLookupBy checks if the query type supports the lookupBy property, an empty property selects the default
+func isValidLookupBy(queryType, lookupBy string) bool {
+	if lookupBy == "" {
+		return true
+	}
+	for _, property := range lookupProperties[queryType] {
+		if property == lookupBy {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupProperty returns the property to look up a name by. Without lookupBy,
+// application names that are GUIDs are looked up by appId, and the group names
+// of membership checks that are GUIDs by id.
+func lookupProperty(in *v1beta1.Input, name string) string {
+	if in.LookupBy != "" {
+		return in.LookupBy
+	}
+	if in.QueryType == "ApplicationDetails" && isGUID(name) {
+		return lookupByAppID
+	}
+	if in.QueryType == "CheckMembership" && isGUID(name) {
+		return lookupByID
+	}
+	if properties, ok := lookupProperties[in.QueryType]; ok {
+		return properties[0]
+	}
+	return lookupByDisplayName
+}
+
+// lookupObjects looks up the objects whose property equals value, following
+// result pages up to limit. Objects looked up by id are read directly with get,
+// and an id that does not exist returns no objects rather than an error. Other
+// properties are looked up with list, using an $filter built by eqFilter.
+func lookupObjects[T interface{}](ctx context.Context, client *msgraphsdk.GraphServiceClient, property, value string, limit int,
+	get func(id string) (T, error), list func(filter string) (interface{}, error), factory serialization.ParsableFactory) ([]T, bool, error) {
+	if property == lookupByID {
+		if !isGUID(value) {
+			return nil, false, errors.New("invalid id: value must be a GUID")
+		}
+		object, err := get(value)
+		if isNotFound(err) {
+			return nil, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		return []T{object}, false, nil
+	}
+
+	filter, err := eqFilter(property, value)
+	if err != nil {
+		return nil, false, err
+	}
+	firstPage, err := list(filter)
+	if err != nil {
+		return nil, false, err
+	}
+	return collectPages[T](ctx, client, firstPage, factory, limit)
+}
+
+// isNotFound checks if an error is a Microsoft Graph 404 Not Found response
+func isNotFound(err error) bool {
+	var apiErr abstractions.ApiErrorable
+	return errors.As(err, &apiErr) && apiErr.GetStatusCode() == http.StatusNotFound
+}
+
+// guidRegex matches the string form of a GUID, such as an object ID or appId
+var guidRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// isGUID checks if a value is a GUID
+func isGUID(value string) bool {
+	return guidRegex.MatchString(value)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/upbound/function-msgraph/input/v1beta1"
+)
+
+func TestLookupBy(t *testing.T) {
+	client := newFakeGraphClient(t, map[string]string{
+		"/v1.0/users/11111111-1111-1111-1111-111111111111":         `{"id": "11111111-1111-1111-1111-111111111111", "userPrincipalName": "user1@example.com"}`,
+		"/v1.0/groups/22222222-2222-2222-2222-222222222222":        `{"id": "22222222-2222-2222-2222-222222222222", "displayName": "Developers"}`,
+		"/v1.0/groups/22222222-2222-2222-2222-222222222222/owners": `{"value": []}`,
+		"/v1.0/servicePrincipals?$filter=appId eq '33333333-3333-3333-3333-333333333333'": `{
+			"value": [{"id": "sp-1", "appId": "33333333-3333-3333-3333-333333333333", "displayName": "MyServiceApp"}]
+		}`,
+	})
+
+	type want struct {
+		ids []string
+		err string
+	}
+
+	cases := map[string]struct {
+		reason string
+		in     *v1beta1.Input
+		query  func(g *GraphQuery, in *v1beta1.Input) (interface{}, error)
+		want   want
+	}{
+		"UserByID": {
+			reason: "A user looked up by id should be read directly, and an unknown id should return no result",
+			in: &v1beta1.Input{
+				QueryType: "UserValidation",
+				LookupBy:  "id",
+				Users:     []*string{strPtr("11111111-1111-1111-1111-111111111111"), strPtr("99999999-9999-9999-9999-999999999999")},
+			},
+			query: func(g *GraphQuery, in *v1beta1.Input) (interface{}, error) {
+				return g.validateUsers(context.Background(), client, in)
+			},
+			want: want{ids: []string{"11111111-1111-1111-1111-111111111111"}},
+		},
+		"GroupOwnersByID": {
+			reason: "A group looked up by id should be read directly",
+			in: &v1beta1.Input{
+				QueryType: "GroupOwners",
+				LookupBy:  "id",
+				Groups:    []*string{strPtr("22222222-2222-2222-2222-222222222222")},
+			},
+			query: func(g *GraphQuery, in *v1beta1.Input) (interface{}, error) {
+				return g.getGroupOwners(context.Background(), client, in)
+			},
+			want: want{ids: []string{"22222222-2222-2222-2222-222222222222"}},
+		},
+		"UnknownGroupID": {
+			reason: "A group membership query for an unknown group id should fail as for an unknown name",
+			in: &v1beta1.Input{
+				QueryType: "GroupMembership",
+				LookupBy:  "id",
+				Group:     strPtr("99999999-9999-9999-9999-999999999999"),
+			},
+			query: func(g *GraphQuery, in *v1beta1.Input) (interface{}, error) {
+				return g.getGroupMembers(context.Background(), client, in)
+			},
+			want: want{err: "group not found: 99999999-9999-9999-9999-999999999999"},
+		},
+		"ServicePrincipalByAppID": {
+			reason: "A service principal looked up by appId should be filtered on appId",
+			in: &v1beta1.Input{
+				QueryType:         "ServicePrincipalDetails",
+				LookupBy:          "appId",
+				ServicePrincipals: []*string{strPtr("33333333-3333-3333-3333-333333333333")},
+			},
+			query: func(g *GraphQuery, in *v1beta1.Input) (interface{}, error) {
+				return g.getServicePrincipalDetails(context.Background(), client, in)
+			},
+			want: want{ids: []string{"sp-1"}},
+		},
+		"InvalidID": {
+			reason: "An id that is not a GUID should be rejected rather than be put in the request path",
+			in: &v1beta1.Input{
+				QueryType:         "ServicePrincipalDetails",
+				LookupBy:          "id",
+				ServicePrincipals: []*string{strPtr("../users")},
+			},
+			query: func(g *GraphQuery, in *v1beta1.Input) (interface{}, error) {
+				return g.getServicePrincipalDetails(context.Background(), client, in)
+			},
+			want: want{err: "failed to find service principal ../users: invalid id: value must be a GUID"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			results, err := tc.query(&GraphQuery{}, tc.in)
+
+			var ids []string
+			if items, ok := results.([]interface{}); ok {
+				for _, item := range items {
+					if id, ok := stringValue(item.(map[string]interface{})["id"]); ok {
+						ids = append(ids, id)
+					}
+				}
+			}
+			if diff := cmp.Diff(tc.want.ids, ids, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("%s\n%s query: -want ids, +got ids:\n%s", tc.reason, tc.in.QueryType, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, errString(err)); diff != "" {
+				t.Errorf("%s\n%s query: -want err, +got err:\n%s", tc.reason, tc.in.QueryType, diff)
+			}
+		})
+	}
+}
+
+func TestIsValidLookupBy(t *testing.T) {
+	cases := map[string]struct {
+		reason    string
+		queryType string
+		lookupBy  string
+		want      bool
+	}{
+		"Default": {
+			reason:    "An empty lookupBy should select the default property of any query type",
+			queryType: "UserValidation",
+			want:      true,
+		},
+		"UserByID": {
+			reason:    "Users should be looked up by id",
+			queryType: "UserValidation",
+			lookupBy:  "id",
+			want:      true,
+		},
+		"UserByAppID": {
+			reason:    "Users have no appId to be looked up by",
+			queryType: "UserValidation",
+			lookupBy:  "appId",
+		},
+		"ServicePrincipalByAppID": {
+			reason:    "Service principals should be looked up by appId",
+			queryType: "ServicePrincipalDetails",
+			lookupBy:  "appId",
+			want:      true,
+		},
+		"GroupByUserPrincipalName": {
+			reason:    "Groups have no userPrincipalName to be looked up by",
+			queryType: "GroupObjectIDs",
+			lookupBy:  "userPrincipalName",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := isValidLookupBy(tc.queryType, tc.lookupBy); got != tc.want {
+				t.Errorf("%s\nisValidLookupBy(%q, %q): want %t, got %t", tc.reason, tc.queryType, tc.lookupBy, tc.want, got)
+			}
+		})
+	}
+}
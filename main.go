@@ -16,6 +16,8 @@ type CLI struct {
 	TLSCertsDir        string `help:"Directory containing server certs (tls.key, tls.crt) and the CA used to verify client certificates (ca.crt)" env:"TLS_SERVER_CERTS_DIR"`
 	Insecure           bool   `help:"Run without mTLS credentials. If you supply this flag --tls-server-certs-dir will be ignored."`
 	MaxRecvMessageSize int    `help:"Maximum size of received messages in MB." default:"4"`
+
+	CustomPathPrefixes []string `help:"Microsoft Graph path prefixes that Custom queries may read (e.g. /groups). Defaults to the common directory object paths." env:"CUSTOM_PATH_PREFIXES"`
 }
 
 // Run this Function.
@@ -27,7 +29,7 @@ func (c *CLI) Run() error {
 
 	return function.Serve(&Function{
 		log:        log,
-		graphQuery: &GraphQuery{},
+		graphQuery: &GraphQuery{allowedPaths: c.CustomPathPrefixes},
 	},
 		function.Listen(c.Network, c.Address),
 		function.MTLSCertificates(c.TLSCertsDir),
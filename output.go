@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/upbound/function-msgraph/input/v1beta1"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+)
+
+const (
+	// outputFormatList stores the results as the query returns them
+	outputFormatList = "List"
+	// outputFormatMapByName stores the results keyed by the name they were looked up by
+	outputFormatMapByName = "MapByName"
+	// outputFormatMapByID stores the results keyed by object ID
+	outputFormatMapByID = "MapByID"
+	// outputFormatIDsOnly stores a list of the object IDs of the results
+	outputFormatIDsOnly = "IDsOnly"
+)
+
+// mapByNameQueryTypes lists the query types whose results can be keyed by the
+// name they were looked up by
+var mapByNameQueryTypes = map[string]bool{
+	"UserValidation":          true,
+	"GroupObjectIDs":          true,
+	"ServicePrincipalDetails": true,
+	"ApplicationDetails":      true,
+}
+
+// isValidOutputFormat checks if the query type supports the output format, an
+// empty format defaults to List. The results of UserMemberOf and CheckMembership
+// queries are already keyed by name, and are only output as a List.
+func isValidOutputFormat(queryType, format string) bool {
+	switch format {
+	case "", outputFormatList:
+		return true
+	case outputFormatMapByName:
+		return mapByNameQueryTypes[queryType]
+	case outputFormatMapByID, outputFormatIDsOnly:
+		return queryType != "UserMemberOf" && queryType != "CheckMembership"
+	}
+	return false
+}
+
+// formatResults reshapes a list of results as the output format of the input
+// says. Results are keyed by their object ID, or by the property their name was
+// looked up by, which must be unique across the results.
+func formatResults(in *v1beta1.Input, results interface{}) (interface{}, error) {
+	if in.OutputFormat == "" || in.OutputFormat == outputFormatList {
+		return results, nil
+	}
+	items, ok := results.([]interface{})
+	if !ok && results != nil {
+		return nil, errors.Errorf("cannot output %s results as %s: results are not a list", in.QueryType, in.OutputFormat)
+	}
+
+	if in.OutputFormat == outputFormatIDsOnly {
+		ids := make([]interface{}, 0, len(items))
+		for _, item := range items {
+			id, err := resultKey(item, lookupByID)
+			if err != nil {
+				return nil, errors.Wrapf(err, "cannot output %s results as %s", in.QueryType, in.OutputFormat)
+			}
+			ids = append(ids, id)
+		}
+		return ids, nil
+	}
+
+	keyed := make(map[string]interface{}, len(items))
+	for _, item := range items {
+		field := lookupByID
+		if in.OutputFormat == outputFormatMapByName {
+			field = nameProperty(in, item)
+		}
+		key, err := resultKey(item, field)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot output %s results as %s", in.QueryType, in.OutputFormat)
+		}
+		if _, ok := keyed[key]; ok {
+			return nil, errors.Errorf("cannot output %s results as %s: more than one result has %s %s", in.QueryType, in.OutputFormat, field, key)
+		}
+		keyed[key] = item
+	}
+	return keyed, nil
+}
+
+// nameProperty returns the property a result was looked up by. That is the
+// lookup property of the requested name the result matches, as application
+// names that are GUIDs are looked up by appId, or else the default lookup
+// property of the query type.
+func nameProperty(in *v1beta1.Input, item interface{}) string {
+	m, _ := item.(map[string]interface{})
+	for _, name := range requestedNames(in) {
+		if name == nil {
+			continue
+		}
+		field := lookupProperty(in, *name)
+		if value, ok := stringValue(m[field]); ok && strings.EqualFold(value, *name) {
+			return field
+		}
+	}
+	return lookupProperty(in, "")
+}
+
+// resultKey returns the value of a result property to key the result by
+func resultKey(item interface{}, field string) (string, error) {
+	m, ok := item.(map[string]interface{})
+	if !ok {
+		return "", errors.New("result is not an object")
+	}
+	key, ok := stringValue(m[field])
+	if !ok || key == "" {
+		return "", errors.Errorf("result has no %s", field)
+	}
+	return key, nil
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/upbound/function-msgraph/input/v1beta1"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+func TestIsValidOutputFormat(t *testing.T) {
+	cases := map[string]struct {
+		reason    string
+		queryType string
+		format    string
+		want      bool
+	}{
+		"Default": {
+			reason:    "An empty output format should default to List",
+			queryType: "UserMemberOf",
+			want:      true,
+		},
+		"MapByName": {
+			reason:    "Service principals should be keyable by name",
+			queryType: "ServicePrincipalDetails",
+			format:    "MapByName",
+			want:      true,
+		},
+		"MapByNameUnsupported": {
+			reason:    "Group members should not be keyable by name, as they are not looked up by name",
+			queryType: "GroupMembership",
+			format:    "MapByName",
+		},
+		"MapByID": {
+			reason:    "Group members should be keyable by ID",
+			queryType: "GroupMembership",
+			format:    "MapByID",
+			want:      true,
+		},
+		"IDsOnlyUnsupported": {
+			reason:    "Results already keyed by name should only be output as a List",
+			queryType: "CheckMembership",
+			format:    "IDsOnly",
+		},
+		"Unknown": {
+			reason:    "An unknown output format should be invalid",
+			queryType: "GroupObjectIDs",
+			format:    "Map",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := isValidOutputFormat(tc.queryType, tc.format)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nisValidOutputFormat(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestFormatResults(t *testing.T) {
+	admins := map[string]interface{}{"id": "group-1", "displayName": "platform-admins"}
+	operators := map[string]interface{}{"id": strPtr("group-2"), "displayName": strPtr("platform-operators")}
+	spA := map[string]interface{}{"id": "sp-1", "appId": "app-1", "displayName": "api"}
+	spB := map[string]interface{}{"id": "sp-2", "appId": "app-2", "displayName": "api"}
+	appA := map[string]interface{}{"id": "app-object-1", "appId": "00000000-0000-0000-0000-000000000001", "displayName": "My App"}
+	appB := map[string]interface{}{"id": "app-object-2", "appId": "00000000-0000-0000-0000-000000000002", "displayName": "Second App"}
+
+	type want struct {
+		results interface{}
+		err     string
+	}
+
+	cases := map[string]struct {
+		reason  string
+		in      *v1beta1.Input
+		results interface{}
+		want    want
+	}{
+		"List": {
+			reason:  "Results should be returned as is by default",
+			in:      &v1beta1.Input{QueryType: "GroupObjectIDs"},
+			results: []interface{}{admins, operators},
+			want:    want{results: []interface{}{admins, operators}},
+		},
+		"MapByName": {
+			reason:  "Groups should be keyed by display name, including names held by pointers",
+			in:      &v1beta1.Input{QueryType: "GroupObjectIDs", OutputFormat: "MapByName"},
+			results: []interface{}{admins, operators},
+			want: want{results: map[string]interface{}{
+				"platform-admins":    admins,
+				"platform-operators": operators,
+			}},
+		},
+		"MapByNameLookupBy": {
+			reason:  "Service principals looked up by app ID should be keyed by app ID",
+			in:      &v1beta1.Input{QueryType: "ServicePrincipalDetails", LookupBy: "appId", OutputFormat: "MapByName"},
+			results: []interface{}{spA, spB},
+			want: want{results: map[string]interface{}{
+				"app-1": spA,
+				"app-2": spB,
+			}},
+		},
+		"MapByNameApplicationGUID": {
+			reason: "Applications looked up by a GUID should be keyed by app ID, and the others by display name",
+			in: &v1beta1.Input{
+				QueryType:    "ApplicationDetails",
+				Applications: []*string{strPtr("My App"), strPtr("00000000-0000-0000-0000-000000000002")},
+				OutputFormat: "MapByName",
+			},
+			results: []interface{}{appA, appB},
+			want: want{results: map[string]interface{}{
+				"My App":                               appA,
+				"00000000-0000-0000-0000-000000000002": appB,
+			}},
+		},
+		"MapByNameUsers": {
+			reason:  "Users should be keyed by user principal name",
+			in:      &v1beta1.Input{QueryType: "UserValidation", OutputFormat: "MapByName"},
+			results: []interface{}{map[string]interface{}{"id": "user-1", "userPrincipalName": "user1@example.com"}},
+			want: want{results: map[string]interface{}{
+				"user1@example.com": map[string]interface{}{"id": "user-1", "userPrincipalName": "user1@example.com"},
+			}},
+		},
+		"MapByNameDuplicate": {
+			reason:  "Results sharing a name should fail rather than overwrite each other",
+			in:      &v1beta1.Input{QueryType: "ServicePrincipalDetails", OutputFormat: "MapByName"},
+			results: []interface{}{spA, spB},
+			want:    want{err: "cannot output ServicePrincipalDetails results as MapByName: more than one result has displayName api"},
+		},
+		"MapByID": {
+			reason:  "Results should be keyed by object ID",
+			in:      &v1beta1.Input{QueryType: "ServicePrincipalDetails", OutputFormat: "MapByID"},
+			results: []interface{}{spA, spB},
+			want: want{results: map[string]interface{}{
+				"sp-1": spA,
+				"sp-2": spB,
+			}},
+		},
+		"IDsOnly": {
+			reason:  "Results should be reduced to their object IDs",
+			in:      &v1beta1.Input{QueryType: "GroupObjectIDs", OutputFormat: "IDsOnly"},
+			results: []interface{}{admins, operators},
+			want:    want{results: []interface{}{"group-1", "group-2"}},
+		},
+		"NoResults": {
+			reason:  "No results should be output as an empty map",
+			in:      &v1beta1.Input{QueryType: "Custom", OutputFormat: "MapByID"},
+			results: []interface{}(nil),
+			want:    want{results: map[string]interface{}{}},
+		},
+		"NoID": {
+			reason:  "Results without an object ID should fail",
+			in:      &v1beta1.Input{QueryType: "Custom", OutputFormat: "IDsOnly"},
+			results: []interface{}{map[string]interface{}{"displayName": "example.com"}},
+			want:    want{err: "cannot output Custom results as IDsOnly: result has no id"},
+		},
+		"NotAList": {
+			reason:  "A single object should not be reshaped",
+			in:      &v1beta1.Input{QueryType: "Custom", OutputFormat: "MapByID"},
+			results: map[string]interface{}{"id": "org-1"},
+			want:    want{err: "cannot output Custom results as MapByID: results are not a list"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := formatResults(tc.in, tc.results)
+
+			if diff := cmp.Diff(tc.want.err, errString(err)); diff != "" {
+				t.Fatalf("%s\nformatResults(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, got); diff != "" {
+				t.Errorf("%s\nformatResults(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionOutputFormats(t *testing.T) {
+	groups := []interface{}{
+		map[string]interface{}{"id": "group-2", "displayName": "platform-operators"},
+		map[string]interface{}{"id": "group-1", "displayName": "platform-admins"},
+	}
+	apps := []interface{}{
+		map[string]interface{}{"id": "app-object-1", "appId": "00000000-0000-0000-0000-000000000009", "displayName": "My App"},
+		map[string]interface{}{"id": "app-object-2", "appId": "00000000-0000-0000-0000-000000000001", "displayName": "Second App"},
+	}
+	sps := []interface{}{
+		map[string]interface{}{"id": "sp-1", "appId": "00000000-0000-0000-0000-000000000001", "displayName": "api"},
+		map[string]interface{}{"id": "sp-2", "appId": "00000000-0000-0000-0000-000000000002", "displayName": "api"},
+	}
+
+	type want struct {
+		value string
+		fatal string
+	}
+
+	cases := map[string]struct {
+		reason  string
+		input   string
+		results interface{}
+		want    want
+	}{
+		"List": {
+			reason:  "Results should be stored as a list sorted by id by default",
+			input:   `{"queryType": "GroupObjectIDs", "groups": ["platform-admins", "platform-operators"], "target": "status.groups"}`,
+			results: groups,
+			want: want{value: `[
+				{"id": "group-1", "displayName": "platform-admins"},
+				{"id": "group-2", "displayName": "platform-operators"}
+			]`},
+		},
+		"MapByName": {
+			reason:  "Groups should be stored keyed by display name",
+			input:   `{"queryType": "GroupObjectIDs", "groups": ["platform-admins", "platform-operators"], "outputFormat": "MapByName", "target": "status.groups"}`,
+			results: groups,
+			want: want{value: `{
+				"platform-admins": {"id": "group-1", "displayName": "platform-admins"},
+				"platform-operators": {"id": "group-2", "displayName": "platform-operators"}
+			}`},
+		},
+		"MapByNameApplicationGUIDs": {
+			reason:  "Applications looked up by a GUID should be stored keyed by app ID, and the others by display name",
+			input:   `{"queryType": "ApplicationDetails", "applications": ["My App", "00000000-0000-0000-0000-000000000001"], "outputFormat": "MapByName", "target": "status.apps"}`,
+			results: apps,
+			want: want{value: `{
+				"My App": {"id": "app-object-1", "appId": "00000000-0000-0000-0000-000000000009", "displayName": "My App"},
+				"00000000-0000-0000-0000-000000000001": {"id": "app-object-2", "appId": "00000000-0000-0000-0000-000000000001", "displayName": "Second App"}
+			}`},
+		},
+		"MapByNameServicePrincipalAppIDs": {
+			reason:  "Service principals looked up by app ID should be stored keyed by app ID, even if they share a display name",
+			input:   `{"queryType": "ServicePrincipalDetails", "servicePrincipals": ["00000000-0000-0000-0000-000000000001", "00000000-0000-0000-0000-000000000002"], "lookupBy": "appId", "outputFormat": "MapByName", "target": "context.sps"}`,
+			results: sps,
+			want: want{value: `{
+				"00000000-0000-0000-0000-000000000001": {"id": "sp-1", "appId": "00000000-0000-0000-0000-000000000001", "displayName": "api"},
+				"00000000-0000-0000-0000-000000000002": {"id": "sp-2", "appId": "00000000-0000-0000-0000-000000000002", "displayName": "api"}
+			}`},
+		},
+		"MapByNameDuplicate": {
+			reason:  "Service principals looked up by a display name they share should fail rather than overwrite each other",
+			input:   `{"queryType": "ServicePrincipalDetails", "servicePrincipals": ["api"], "outputFormat": "MapByName", "target": "status.sps"}`,
+			results: sps,
+			want:    want{fatal: "cannot output ServicePrincipalDetails results as MapByName: more than one result has displayName api"},
+		},
+		"MapByID": {
+			reason:  "Results should be stored keyed by object ID",
+			input:   `{"queryType": "ServicePrincipalDetails", "servicePrincipals": ["api"], "outputFormat": "MapByID", "target": "status.sps"}`,
+			results: sps,
+			want: want{value: `{
+				"sp-1": {"id": "sp-1", "appId": "00000000-0000-0000-0000-000000000001", "displayName": "api"},
+				"sp-2": {"id": "sp-2", "appId": "00000000-0000-0000-0000-000000000002", "displayName": "api"}
+			}`},
+		},
+		"IDsOnly": {
+			reason:  "Results should be stored as a sorted list of their object IDs",
+			input:   `{"queryType": "GroupObjectIDs", "groups": ["platform-admins", "platform-operators"], "outputFormat": "IDsOnly", "target": "context.groupIDs"}`,
+			results: groups,
+			want:    want{value: `["group-1", "group-2"]`},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			value, fatal := runFunctionWithResults(t, tc.input, tc.results)
+
+			if diff := cmp.Diff(tc.want.fatal, fatal); diff != "" {
+				t.Fatalf("%s\nf.RunFunction(...): -want fatal, +got fatal:\n%s", tc.reason, diff)
+			}
+			if tc.want.fatal != "" {
+				return
+			}
+			var want interface{}
+			if err := json.Unmarshal([]byte(tc.want.value), &want); err != nil {
+				t.Fatalf("json.Unmarshal(...): %v", err)
+			}
+			if diff := cmp.Diff(want, value); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want target, +got target:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+// runFunctionWithResults runs the function with an input whose query returns
+// the results, and returns the value stored in the target of the input, and
+// the message of any fatal result
+func runFunctionWithResults(t *testing.T, input string, results interface{}) (interface{}, string) {
+	t.Helper()
+
+	var in map[string]interface{}
+	if err := json.Unmarshal([]byte(input), &in); err != nil {
+		t.Fatalf("json.Unmarshal(...): %v", err)
+	}
+	in["apiVersion"] = "msgraph.fn.crossplane.io/v1alpha1"
+	in["kind"] = "Input"
+	s, err := structpb.NewStruct(in)
+	if err != nil {
+		t.Fatalf("structpb.NewStruct(...): %v", err)
+	}
+
+	f := &Function{
+		graphQuery: &MockGraphQuery{
+			GraphQueryFunc: func(_ context.Context, _ map[string]string, _ *v1beta1.Input) (interface{}, error) {
+				return results, nil
+			},
+		},
+		log: logging.NewNopLogger(),
+	}
+	rsp, err := f.RunFunction(context.Background(), &fnv1.RunFunctionRequest{
+		Input: s,
+		Observed: &fnv1.State{
+			Composite: &fnv1.Resource{
+				Resource: resource.MustStructJSON(`{"apiVersion": "example.org/v1", "kind": "XR", "metadata": {"name": "cool-xr"}}`),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("f.RunFunction(...): unexpected error: %v", err)
+	}
+	for _, r := range rsp.GetResults() {
+		if r.GetSeverity() == fnv1.Severity_SEVERITY_FATAL {
+			return nil, r.GetMessage()
+		}
+	}
+
+	target, _ := in["target"].(string)
+	field := target[strings.Index(target, ".")+1:]
+	if strings.HasPrefix(target, "context.") {
+		return rsp.GetContext().AsMap()[field], ""
+	}
+	status, _ := rsp.GetDesired().GetComposite().GetResource().AsMap()["status"].(map[string]interface{})
+	return status[field], ""
+}
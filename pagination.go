@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+
+	"github.com/microsoft/kiota-abstractions-go/serialization"
+	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
+	msgraphcore "github.com/microsoftgraph/msgraph-sdk-go-core"
+	"github.com/upbound/function-msgraph/input/v1beta1"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+)
+
+const (
+	// defaultMaxResults bounds list query results when the input sets no maxResults
+	defaultMaxResults = 1000
+	// defaultMaxMembers bounds group membership results when the input sets no maxMembers
+	defaultMaxMembers = 10000
+	// memberPageSize is the largest page size Microsoft Graph allows when listing members
+	memberPageSize = 999
+)
+
+// collectPages iterates over a Microsoft Graph collection response, following
+// @odata.nextLink across pages, and returns at most limit items. A limit of
+// zero or less returns every item. The returned bool reports whether items were
+// left out because the limit was reached.
+func collectPages[T interface{}](ctx context.Context, client *msgraphsdk.GraphServiceClient, firstPage interface{}, factory serialization.ParsableFactory, limit int) ([]T, bool, error) {
+	iterator, err := msgraphcore.NewPageIterator[T](firstPage, client.GetAdapter(), factory)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed to create page iterator")
+	}
+
+	var (
+		items     []T
+		truncated bool
+	)
+	err = iterator.Iterate(ctx, func(item T) bool {
+		if limit > 0 && len(items) >= limit {
+			truncated = true
+			return false
+		}
+		items = append(items, item)
+		return true
+	})
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed to iterate over result pages")
+	}
+
+	return items, truncated, nil
+}
+
+// resultLimit is the maximum number of results a list query returns in total
+// across all the names it looks up
+type resultLimit int
+
+// newResultLimit returns the maxResults set in the input, or the default
+func newResultLimit(in *v1beta1.Input) resultLimit {
+	if in.MaxResults != nil {
+		return resultLimit(*in.MaxResults)
+	}
+	return defaultMaxResults
+}
+
+// remaining returns how many more results may be collected once count were
+func (l resultLimit) remaining(count int) int {
+	return int(l) - count
+}
+
+// reached reports whether count results exhaust the limit
+func (l resultLimit) reached(count int) bool {
+	return count >= int(l)
+}
+
+// warn reports that the results of the query were truncated to the limit
+func (l resultLimit) warn(ctx context.Context, queryType string) {
+	addQueryWarning(ctx, "%s results were truncated to maxResults (%d)", queryType, int(l))
+}
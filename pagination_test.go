@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/microsoft/kiota-abstractions-go/authentication"
+	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
+	"github.com/upbound/function-msgraph/input/v1beta1"
+)
+
+// newFakeGraphClient returns a Microsoft Graph client that sends its requests to
+// an httptest server serving the given JSON bodies by request path, followed
+// by any $filter or $skiptoken parameter. Any {{server}} in a body is replaced
+// with the server URL. Other requests get a Microsoft Graph 404 error.
+func newFakeGraphClient(t *testing.T, bodies map[string]string) *msgraphsdk.GraphServiceClient {
+	t.Helper()
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		for _, param := range []string{"$filter", "$skiptoken"} {
+			if value := r.URL.Query().Get(param); value != "" {
+				path += "?" + param + "=" + value
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		body, ok := bodies[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprintf(w, `{"error": {"code": "Request_ResourceNotFound", "message": "Resource '%s' does not exist."}}`, path)
+			return
+		}
+		_, _ = fmt.Fprint(w, strings.ReplaceAll(body, "{{server}}", srv.URL))
+	}))
+	t.Cleanup(srv.Close)
+
+	adapter, err := msgraphsdk.NewGraphRequestAdapterWithParseNodeFactoryAndSerializationWriterFactoryAndHttpClient(
+		&authentication.AnonymousAuthenticationProvider{}, nil, nil, srv.Client())
+	if err != nil {
+		t.Fatalf("NewGraphRequestAdapter(...): unexpected error: %v", err)
+	}
+	adapter.SetBaseUrl(srv.URL + "/v1.0")
+	return msgraphsdk.NewGraphServiceClient(adapter)
+}
+
+func TestGetGroupMembersPagination(t *testing.T) {
+	bodies := map[string]string{
+		"/v1.0/groups?$filter=displayName eq 'Developers'": `{"value": [{"id": "group-1", "displayName": "Developers"}]}`,
+		"/v1.0/groups/group-1/members": `{
+			"value": [
+				{"@odata.type": "#microsoft.graph.user", "id": "user-1", "displayName": "User 1"},
+				{"@odata.type": "#microsoft.graph.user", "id": "user-2", "displayName": "User 2"}
+			],
+			"@odata.nextLink": "{{server}}/v1.0/groups/group-1/members?$skiptoken=page-2"
+		}`,
+		"/v1.0/groups/group-1/members?$skiptoken=page-2": `{
+			"value": [
+				{"@odata.type": "#microsoft.graph.user", "id": "user-3", "displayName": "User 3"},
+				{"@odata.type": "#microsoft.graph.servicePrincipal", "id": "sp-1", "displayName": "SP 1", "appId": "app-1"}
+			]
+		}`,
+		"/v1.0/groups/group-1/members/graph.servicePrincipal": `{
+			"value": [
+				{"@odata.type": "#microsoft.graph.servicePrincipal", "id": "sp-1", "displayName": "SP 1", "appId": "app-1"},
+				{"@odata.type": "#microsoft.graph.servicePrincipal", "id": "sp-2", "displayName": "SP 2", "appId": "app-2"}
+			]
+		}`,
+	}
+
+	cases := map[string]struct {
+		reason       string
+		maxMembers   *int
+		want         []string
+		wantWarnings []string
+	}{
+		"AllPages": {
+			reason: "Members on every page should be returned, plus service principals missing from the member listing",
+			want:   []string{"user:user-1", "user:user-2", "user:user-3", "servicePrincipal:sp-1", "servicePrincipal:sp-2"},
+		},
+		"TruncatedWhilePaging": {
+			reason:       "Paging should stop once maxMembers members were collected",
+			maxMembers:   intPtr(2),
+			want:         []string{"user:user-1", "user:user-2"},
+			wantWarnings: []string{"GroupMembership results for group Developers were truncated to maxMembers (2)"},
+		},
+		"TruncatedWhileMerging": {
+			reason:       "Service principals missing from the member listing should not exceed maxMembers",
+			maxMembers:   intPtr(4),
+			want:         []string{"user:user-1", "user:user-2", "user:user-3", "servicePrincipal:sp-1"},
+			wantWarnings: []string{"GroupMembership results for group Developers were truncated to maxMembers (4)"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			client := newFakeGraphClient(t, bodies)
+			g := &GraphQuery{}
+
+			ctx, warnings := withQueryWarnings(context.Background())
+			results, err := g.getGroupMembers(ctx, client, &v1beta1.Input{
+				QueryType:  "GroupMembership",
+				Group:      strPtr("Developers"),
+				MaxMembers: tc.maxMembers,
+			})
+			if err != nil {
+				t.Fatalf("%s\ngetGroupMembers(...): unexpected error: %v", tc.reason, err)
+			}
+
+			var got []string
+			for _, result := range results.([]interface{}) {
+				member := result.(map[string]interface{})
+				got = append(got, fmt.Sprintf("%s:%s", member["type"], member["id"]))
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\ngetGroupMembers(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.wantWarnings, warnings.list(), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("%s\ngetGroupMembers(...): -want warnings, +got warnings:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestGetGroupObjectIDsPagination(t *testing.T) {
+	bodies := map[string]string{
+		"/v1.0/groups?$filter=displayName eq 'Developers'": `{
+			"value": [
+				{"id": "group-1", "displayName": "Developers"},
+				{"id": "group-2", "displayName": "Developers"}
+			],
+			"@odata.nextLink": "{{server}}/v1.0/groups?$skiptoken=page-2"
+		}`,
+		"/v1.0/groups?$skiptoken=page-2": `{
+			"value": [
+				{"id": "group-3", "displayName": "Developers"}
+			]
+		}`,
+		"/v1.0/groups?$filter=displayName eq 'Operations'": `{
+			"value": [
+				{"id": "group-4", "displayName": "Operations"}
+			]
+		}`,
+	}
+
+	cases := map[string]struct {
+		reason       string
+		maxResults   *int
+		want         []string
+		wantWarnings []string
+	}{
+		"AllPages": {
+			reason: "Groups on every page of every lookup should be returned",
+			want:   []string{"group-1", "group-2", "group-3", "group-4"},
+		},
+		"TruncatedWhilePaging": {
+			reason:       "Paging should stop with a warning once maxResults groups were collected",
+			maxResults:   intPtr(2),
+			want:         []string{"group-1", "group-2"},
+			wantWarnings: []string{"GroupObjectIDs results were truncated to maxResults (2)"},
+		},
+		"TruncatedBetweenLookups": {
+			reason:       "Remaining lookups should be skipped with a warning once maxResults groups were collected",
+			maxResults:   intPtr(3),
+			want:         []string{"group-1", "group-2", "group-3"},
+			wantWarnings: []string{"GroupObjectIDs results were truncated to maxResults (3)"},
+		},
+		"LimitReachedByLastLookup": {
+			reason:     "Reaching maxResults with the last lookup should not be reported as truncation",
+			maxResults: intPtr(4),
+			want:       []string{"group-1", "group-2", "group-3", "group-4"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			client := newFakeGraphClient(t, bodies)
+			g := &GraphQuery{}
+
+			ctx, warnings := withQueryWarnings(context.Background())
+			results, err := g.getGroupObjectIDs(ctx, client, &v1beta1.Input{
+				QueryType:  "GroupObjectIDs",
+				Groups:     []*string{strPtr("Developers"), strPtr("Operations")},
+				MaxResults: tc.maxResults,
+			})
+			if err != nil {
+				t.Fatalf("%s\ngetGroupObjectIDs(...): unexpected error: %v", tc.reason, err)
+			}
+
+			var got []string
+			for _, result := range results.([]interface{}) {
+				got = append(got, result.(map[string]interface{})["id"].(string))
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\ngetGroupObjectIDs(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.wantWarnings, warnings.list(), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("%s\ngetGroupObjectIDs(...): -want warnings, +got warnings:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/upbound/function-msgraph/input/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+)
+
+// defaultResultCacheSize is the maximum number of query results kept by default
+const defaultResultCacheSize = 1024
+
+// queryResultCache memoizes Microsoft Graph query results for the cacheTTL set
+// in the input. Results are stored as JSON so that callers never share, and
+// cannot modify, a cached value. The zero value is ready to use.
+type queryResultCache struct {
+	mu      sync.Mutex
+	entries map[string]queryResultCacheEntry
+
+	// maxEntries bounds the cache size, the entries closest to expiry are evicted first
+	maxEntries int
+	// now returns the current time, it is overridden in tests
+	now func() time.Time
+}
+
+// queryResultCacheEntry is a cached query result, the warnings the query
+// reported and the time it expires
+type queryResultCacheEntry struct {
+	results  []byte
+	warnings []string
+	expires  time.Time
+}
+
+// queryResultCacheKey identifies a query by the tenant it runs against and its normalized input.
+// Fields that do not change the query results, such as the target, sort order, output format and transform, are ignored.
+func queryResultCacheKey(azureCreds map[string]string, in *v1beta1.Input) (string, error) {
+	normalized := in.DeepCopy()
+	normalized.TypeMeta = metav1.TypeMeta{}
+	normalized.ObjectMeta = metav1.ObjectMeta{}
+	normalized.Target = ""
+	normalized.OutputFormat = ""
+	normalized.SortBy = nil
+	normalized.Transform = nil
+	normalized.SkipQueryWhenTargetHasData = nil
+	normalized.CacheTTL = nil
+
+	// References have already been resolved into the lists they point to
+	normalized.UsersRef = nil
+	normalized.GroupsRef = nil
+	normalized.GroupRef = nil
+	normalized.ServicePrincipalsRef = nil
+	normalized.ApplicationsRef = nil
+	normalized.PrincipalRef = nil
+	normalized.RoleRef = nil
+	normalized.ResourceRef = nil
+
+	normalized.Users = normalizeNames(normalized.Users)
+	normalized.Groups = normalizeNames(normalized.Groups)
+	normalized.ServicePrincipals = normalizeNames(normalized.ServicePrincipals)
+	normalized.Applications = normalizeNames(normalized.Applications)
+
+	query, err := json.Marshal(normalized)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot compute query cache key")
+	}
+
+	h := sha256.New()
+	for _, part := range []string{azureCreds["cloud"], azureCreds["tenantId"], azureCreds["clientId"], string(query)} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// normalizeNames drops nil names. The other names are kept exactly as given and
+// in request order, as names are looked up untrimmed, and maxResults stops the
+// lookups at the first name that reaches the limit.
+func normalizeNames(names []*string) []*string {
+	normalized := make([]*string, 0, len(names))
+	for _, name := range names {
+		if name != nil {
+			normalized = append(normalized, name)
+		}
+	}
+	return normalized
+}
+
+// do returns the cached results for the key if they have not expired. Otherwise
+// it runs the query and caches its results for the ttl. A failed query
+// invalidates the key. Warnings reported by the query are cached along with its
+// results and added to ctx on every call. The returned bool reports whether the
+// results were cached.
+func (c *queryResultCache) do(ctx context.Context, key string, ttl time.Duration, query func(ctx context.Context) (interface{}, error)) (interface{}, bool, error) {
+	if results, warnings, ok := c.get(key); ok {
+		addQueryWarnings(ctx, warnings)
+		return results, true, nil
+	}
+
+	queryCtx, collected := withQueryWarnings(ctx)
+	results, err := query(queryCtx)
+	warnings := collected.list()
+	addQueryWarnings(ctx, warnings)
+	if err != nil {
+		c.invalidate(key)
+		return nil, false, err
+	}
+
+	if err := c.set(key, results, warnings, ttl); err != nil {
+		return nil, false, err
+	}
+	return results, false, nil
+}
+
+// get returns a copy of the unexpired results, and the warnings, cached for the key
+func (c *queryResultCache) get(key string) (interface{}, []string, bool) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok && !c.timeNow().Before(entry.expires) {
+		delete(c.entries, key)
+		ok = false
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		return nil, nil, false
+	}
+
+	var results interface{}
+	if err := json.Unmarshal(entry.results, &results); err != nil {
+		return nil, nil, false
+	}
+	return results, entry.warnings, true
+}
+
+// set caches the results and warnings for the key until the ttl elapses
+func (c *queryResultCache) set(key string, results interface{}, warnings []string, ttl time.Duration) error {
+	data, err := json.Marshal(results)
+	if err != nil {
+		return errors.Wrap(err, "cannot cache query results")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]queryResultCacheEntry)
+	}
+
+	now := c.timeNow()
+	for k, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.size() {
+		c.evictClosestToExpiry()
+	}
+
+	c.entries[key] = queryResultCacheEntry{results: data, warnings: warnings, expires: now.Add(ttl)}
+	return nil
+}
+
+// invalidate removes the results cached for the key
+func (c *queryResultCache) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// evictClosestToExpiry removes the entry that expires first
+func (c *queryResultCache) evictClosestToExpiry() {
+	var (
+		firstKey     string
+		firstExpires time.Time
+	)
+	for key, entry := range c.entries {
+		if firstKey == "" || entry.expires.Before(firstExpires) {
+			firstKey, firstExpires = key, entry.expires
+		}
+	}
+	delete(c.entries, firstKey)
+}
+
+func (c *queryResultCache) size() int {
+	if c.maxEntries > 0 {
+		return c.maxEntries
+	}
+	return defaultResultCacheSize
+}
+
+func (c *queryResultCache) timeNow() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/upbound/function-msgraph/input/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+)
+
+func TestQueryResultCacheKey(t *testing.T) {
+	creds := map[string]string{"tenantId": "tenant-a", "clientId": "client"}
+	base := &v1beta1.Input{
+		QueryType: "GroupObjectIDs",
+		Groups:    []*string{strPtr("Developers"), strPtr("Operations")},
+		Target:    "status.groups",
+	}
+
+	cases := map[string]struct {
+		reason string
+		creds  map[string]string
+		in     *v1beta1.Input
+		same   bool
+	}{
+		"NilNames": {
+			reason: "Nil names are not looked up and should not change the key",
+			creds:  creds,
+			in: &v1beta1.Input{
+				QueryType: "GroupObjectIDs",
+				Groups:    []*string{strPtr("Developers"), nil, strPtr("Operations")},
+				Target:    "status.groups",
+			},
+			same: true,
+		},
+		"ReorderedNames": {
+			reason: "Names in a different order should not share a key, as maxResults stops the lookups at the first name reaching the limit",
+			creds:  creds,
+			in: &v1beta1.Input{
+				QueryType: "GroupObjectIDs",
+				Groups:    []*string{strPtr("Operations"), strPtr("Developers")},
+				Target:    "status.groups",
+			},
+		},
+		"UntrimmedNames": {
+			reason: "Names are looked up untrimmed, so names differing in whitespace should not share a key",
+			creds:  creds,
+			in: &v1beta1.Input{
+				QueryType: "GroupObjectIDs",
+				Groups:    []*string{strPtr(" Developers"), strPtr("Operations")},
+				Target:    "status.groups",
+			},
+		},
+		"DifferentTarget": {
+			reason: "The target, sort order, output format and transform do not change the query results and should not change the key",
+			creds:  creds,
+			in: &v1beta1.Input{
+				QueryType:    "GroupObjectIDs",
+				Groups:       []*string{strPtr("Developers"), strPtr("Operations")},
+				Target:       "context.groups",
+				OutputFormat: "MapByName",
+				SortBy:       strPtr("displayName"),
+				Transform:    strPtr("results.map(g, g.id)"),
+				CacheTTL:     &metav1.Duration{Duration: time.Minute},
+			},
+			same: true,
+		},
+		"DifferentTenant": {
+			reason: "The same query against another tenant should not share a key",
+			creds:  map[string]string{"tenantId": "tenant-b", "clientId": "client"},
+			in:     base,
+		},
+		"DifferentQueryType": {
+			reason: "Another query type should not share a key",
+			creds:  creds,
+			in: &v1beta1.Input{
+				QueryType:         "ServicePrincipalDetails",
+				ServicePrincipals: []*string{strPtr("Developers"), strPtr("Operations")},
+				Target:            "status.groups",
+			},
+		},
+		"DifferentNames": {
+			reason: "Other names should not share a key",
+			creds:  creds,
+			in: &v1beta1.Input{
+				QueryType: "GroupObjectIDs",
+				Groups:    []*string{strPtr("Developers")},
+				Target:    "status.groups",
+			},
+		},
+	}
+
+	baseKey, err := queryResultCacheKey(creds, base)
+	if err != nil {
+		t.Fatalf("queryResultCacheKey(...): unexpected error: %v", err)
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			key, err := queryResultCacheKey(tc.creds, tc.in)
+			if err != nil {
+				t.Fatalf("%s\nqueryResultCacheKey(...): unexpected error: %v", tc.reason, err)
+			}
+			if got := key == baseKey; got != tc.same {
+				t.Errorf("%s\nqueryResultCacheKey(...): want same key %t, got %t", tc.reason, tc.same, got)
+			}
+		})
+	}
+}
+
+func TestQueryResultCacheKeyMaxResults(t *testing.T) {
+	creds := map[string]string{"tenantId": "tenant-a", "clientId": "client"}
+	in := func(groups ...string) *v1beta1.Input {
+		names := make([]*string, 0, len(groups))
+		for _, group := range groups {
+			names = append(names, strPtr(group))
+		}
+		return &v1beta1.Input{QueryType: "GroupObjectIDs", Groups: names, MaxResults: intPtr(1), Target: "status.groups"}
+	}
+
+	first, err := queryResultCacheKey(creds, in("Developers", "Operations"))
+	if err != nil {
+		t.Fatalf("queryResultCacheKey(...): unexpected error: %v", err)
+	}
+	second, err := queryResultCacheKey(creds, in("Operations", "Developers"))
+	if err != nil {
+		t.Fatalf("queryResultCacheKey(...): unexpected error: %v", err)
+	}
+	if first == second {
+		t.Errorf("queryResultCacheKey(...): reordered names truncated by maxResults return other results, and should not share a key")
+	}
+}
+
+func TestQueryResultCache(t *testing.T) {
+	now := time.Now()
+	cache := &queryResultCache{now: func() time.Time { return now }}
+
+	calls := 0
+	results := []interface{}{map[string]interface{}{"id": "group-id-1"}}
+	query := func(context.Context) (interface{}, error) {
+		calls++
+		return results, nil
+	}
+	failing := func(context.Context) (interface{}, error) {
+		calls++
+		return nil, errors.New("boom")
+	}
+
+	type want struct {
+		results interface{}
+		cached  bool
+		err     string
+		calls   int
+	}
+
+	steps := []struct {
+		reason  string
+		advance time.Duration
+		query   func(context.Context) (interface{}, error)
+		want    want
+	}{
+		{
+			reason: "The first call should run the query",
+			query:  query,
+			want:   want{results: results, calls: 1},
+		},
+		{
+			reason:  "A call within the TTL should be served from the cache",
+			advance: 4 * time.Minute,
+			query:   query,
+			want:    want{results: results, cached: true, calls: 1},
+		},
+		{
+			reason:  "A call after the TTL should run the query again",
+			advance: 2 * time.Minute,
+			query:   query,
+			want:    want{results: results, calls: 2},
+		},
+		{
+			reason:  "An expired entry whose refresh fails should be invalidated",
+			advance: 6 * time.Minute,
+			query:   failing,
+			want:    want{err: "boom", calls: 3},
+		},
+		{
+			reason: "The call after a failure should run the query again",
+			query:  query,
+			want:   want{results: results, calls: 4},
+		},
+	}
+
+	for i, step := range steps {
+		now = now.Add(step.advance)
+
+		got, cached, err := cache.do(context.Background(), "key", 5*time.Minute, step.query)
+		if diff := cmp.Diff(step.want.err, errString(err)); diff != "" {
+			t.Errorf("step %d: %s\ndo(...): -want err, +got err:\n%s", i, step.reason, diff)
+		}
+		if diff := cmp.Diff(step.want.results, got); diff != "" {
+			t.Errorf("step %d: %s\ndo(...): -want results, +got results:\n%s", i, step.reason, diff)
+		}
+		if cached != step.want.cached {
+			t.Errorf("step %d: %s\ndo(...): want cached %t, got %t", i, step.reason, step.want.cached, cached)
+		}
+		if calls != step.want.calls {
+			t.Errorf("step %d: %s\ndo(...): want %d query calls, got %d", i, step.reason, step.want.calls, calls)
+		}
+	}
+}
+
+func TestQueryResultCacheReturnsCopies(t *testing.T) {
+	cache := &queryResultCache{}
+	if err := cache.set("key", []interface{}{map[string]interface{}{"id": "a"}}, nil, time.Minute); err != nil {
+		t.Fatalf("set(...): unexpected error: %v", err)
+	}
+
+	first, _, _ := cache.get("key")
+	first.([]interface{})[0].(map[string]interface{})["id"] = "modified"
+
+	second, _, _ := cache.get("key")
+	if diff := cmp.Diff([]interface{}{map[string]interface{}{"id": "a"}}, second); diff != "" {
+		t.Errorf("get(...): modifying returned results should not modify the cache: -want, +got:\n%s", diff)
+	}
+}
+
+func TestQueryResultCacheReplaysWarnings(t *testing.T) {
+	cache := &queryResultCache{}
+	query := func(ctx context.Context) (interface{}, error) {
+		addQueryWarning(ctx, "results were truncated")
+		return []interface{}{}, nil
+	}
+
+	for _, reason := range []string{
+		"Warnings reported by the query should be added to the context",
+		"Warnings cached along with the results should be added to the context again",
+	} {
+		ctx, warnings := withQueryWarnings(context.Background())
+		if _, _, err := cache.do(ctx, "key", time.Minute, query); err != nil {
+			t.Fatalf("%s\ndo(...): unexpected error: %v", reason, err)
+		}
+		if diff := cmp.Diff([]string{"results were truncated"}, warnings.list()); diff != "" {
+			t.Errorf("%s\ndo(...): -want warnings, +got warnings:\n%s", reason, diff)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	khttp "github.com/microsoft/kiota-http-go"
+	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
+	msgraphcore "github.com/microsoftgraph/msgraph-sdk-go-core"
+)
+
+const (
+	// defaultMaxRetries is how often a throttled request is retried by default
+	defaultMaxRetries = 5
+	// defaultRetryBaseDelay is the initial backoff delay between retries by default
+	defaultRetryBaseDelay = time.Second
+	// defaultRetryMaxDelay caps the backoff delay between retries by default
+	defaultRetryMaxDelay = 30 * time.Second
+)
+
+// throttledError is returned when Microsoft Graph kept throttling a request
+// until the retries were exhausted or the request context ran out of time.
+type throttledError struct {
+	statusCode int
+	attempts   int
+}
+
+func (e *throttledError) Error() string {
+	return fmt.Sprintf("request throttled by Microsoft Graph: %d %s after %d attempts", e.statusCode, http.StatusText(e.statusCode), e.attempts)
+}
+
+// retryTransport retries requests that Microsoft Graph answered with 429 Too
+// Many Requests or 503 Service Unavailable. It waits for the delay requested
+// by the Retry-After header, or else for a jittered exponential backoff, and
+// gives up early rather than sleeping past the request context deadline.
+type retryTransport struct {
+	next http.RoundTripper
+
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+
+	// jitter returns a random duration in [0, d), it is overridden in tests
+	jitter func(d time.Duration) time.Duration
+	// sleep waits for d or until ctx is done, it is overridden in tests
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// newGraphHTTPClient returns an HTTP client with the Microsoft Graph middleware
+// pipeline, such as redirect handling, compression and telemetry headers. The
+// kiota retry handler is left out of the pipeline, throttled requests are
+// retried by a retryTransport wrapping it instead.
+func newGraphHTTPClient() *http.Client {
+	options := msgraphsdk.GetDefaultClientOptions()
+	defaults := msgraphcore.GetDefaultMiddlewaresWithOptions(&options)
+	middleware := make([]khttp.Middleware, 0, len(defaults))
+	for _, m := range defaults {
+		if _, ok := m.(*khttp.RetryHandler); ok {
+			continue
+		}
+		middleware = append(middleware, m)
+	}
+
+	client := msgraphcore.GetDefaultClient(&options, middleware...)
+	client.Transport = newRetryTransport(client.Transport)
+	return client
+}
+
+// newRetryTransport returns a retryTransport with the default retry settings
+func newRetryTransport(next http.RoundTripper) *retryTransport {
+	return &retryTransport{
+		next:       next,
+		maxRetries: defaultMaxRetries,
+		baseDelay:  defaultRetryBaseDelay,
+		maxDelay:   defaultRetryMaxDelay,
+		jitter: func(d time.Duration) time.Duration {
+			if d <= 0 {
+				return 0
+			}
+			return time.Duration(rand.Int63n(int64(d))) //nolint:gosec // jitter does not need a secure random source
+		},
+		sleep: sleepContext,
+	}
+}
+
+// RoundTrip sends the request, retrying it while it is throttled
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	// Buffer a body that cannot be read again, so that it can be replayed on retry
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		content, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(ctx)
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(content)), nil
+		}
+		req.Body, _ = req.GetBody()
+	}
+
+	for attempt := 0; ; attempt++ {
+		// Send a copy of the request, as middleware may modify its headers and body
+		r := req.Clone(ctx)
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r.Body = body
+		}
+
+		resp, err := t.next.RoundTrip(r)
+		if err != nil || !isThrottledStatus(resp.StatusCode) {
+			return resp, err
+		}
+
+		if attempt >= t.maxRetries {
+			drainAndClose(resp)
+			return nil, &throttledError{statusCode: resp.StatusCode, attempts: attempt + 1}
+		}
+
+		// Give up rather than wait longer than allowed or past the context deadline
+		delay := t.delay(attempt, resp)
+		drainAndClose(resp)
+		if delay > t.maxDelay {
+			return nil, &throttledError{statusCode: resp.StatusCode, attempts: attempt + 1}
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return nil, &throttledError{statusCode: resp.StatusCode, attempts: attempt + 1}
+		}
+
+		if err := t.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// delay returns how long to wait before retrying the throttled response
+func (t *retryTransport) delay(attempt int, resp *http.Response) time.Duration {
+	if d, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+		return d
+	}
+
+	// Exponential backoff with equal jitter, so retries never fire back to back
+	backoff := t.baseDelay << attempt
+	if backoff > t.maxDelay || backoff <= 0 {
+		backoff = t.maxDelay
+	}
+	return backoff/2 + t.jitter(backoff/2)
+}
+
+// isThrottledStatus reports whether a status code asks the client to back off and retry
+func isThrottledStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// drainAndClose discards the rest of the response body so the connection can be reused
+func drainAndClose(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
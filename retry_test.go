@@ -0,0 +1,361 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/microsoft/kiota-abstractions-go/authentication"
+	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
+	"github.com/upbound/function-msgraph/input/v1beta1"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+func TestRetryTransport(t *testing.T) {
+	type response struct {
+		status     int
+		retryAfter string
+	}
+	type want struct {
+		status   int
+		requests int32
+		delays   []time.Duration
+		err      error
+	}
+
+	cases := map[string]struct {
+		reason     string
+		maxRetries int
+		responses  []response
+		timeout    time.Duration
+		want       want
+	}{
+		"NotThrottled": {
+			reason:    "A successful response should be returned without retrying",
+			responses: []response{{status: http.StatusOK}},
+			want: want{
+				status:   http.StatusOK,
+				requests: 1,
+			},
+		},
+		"RetryAfterSeconds": {
+			reason: "A 429 should be retried after the delay given in Retry-After",
+			responses: []response{
+				{status: http.StatusTooManyRequests, retryAfter: "2"},
+				{status: http.StatusTooManyRequests, retryAfter: "3"},
+				{status: http.StatusOK},
+			},
+			want: want{
+				status:   http.StatusOK,
+				requests: 3,
+				delays:   []time.Duration{2 * time.Second, 3 * time.Second},
+			},
+		},
+		"ExponentialBackoff": {
+			reason:     "A 503 without Retry-After should be retried with exponential backoff",
+			maxRetries: 3,
+			responses: []response{
+				{status: http.StatusServiceUnavailable},
+				{status: http.StatusServiceUnavailable},
+				{status: http.StatusServiceUnavailable},
+				{status: http.StatusOK},
+			},
+			want: want{
+				status:   http.StatusOK,
+				requests: 4,
+				delays:   []time.Duration{time.Second, 2 * time.Second, 4 * time.Second},
+			},
+		},
+		"RetriesExhausted": {
+			reason: "A request still throttled after the last retry should return a throttledError",
+			responses: []response{
+				{status: http.StatusTooManyRequests, retryAfter: "1"},
+				{status: http.StatusTooManyRequests, retryAfter: "1"},
+				{status: http.StatusTooManyRequests, retryAfter: "1"},
+				{status: http.StatusTooManyRequests, retryAfter: "1"},
+			},
+			want: want{
+				requests: 3,
+				delays:   []time.Duration{time.Second, time.Second},
+				err:      &throttledError{statusCode: http.StatusTooManyRequests, attempts: 3},
+			},
+		},
+		"RetryAfterBeyondMaxDelay": {
+			reason: "A Retry-After longer than the maximum delay should not be waited for",
+			responses: []response{
+				{status: http.StatusTooManyRequests, retryAfter: "120"},
+			},
+			want: want{
+				requests: 1,
+				err:      &throttledError{statusCode: http.StatusTooManyRequests, attempts: 1},
+			},
+		},
+		"RetryAfterBeyondDeadline": {
+			reason: "A Retry-After beyond the context deadline should not be waited for",
+			responses: []response{
+				{status: http.StatusTooManyRequests, retryAfter: "10"},
+			},
+			timeout: 5 * time.Second,
+			want: want{
+				requests: 1,
+				err:      &throttledError{statusCode: http.StatusTooManyRequests, attempts: 1},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var requests int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				i := atomic.AddInt32(&requests, 1) - 1
+				r := tc.responses[i]
+				if r.retryAfter != "" {
+					w.Header().Set("Retry-After", r.retryAfter)
+				}
+				w.WriteHeader(r.status)
+			}))
+			defer srv.Close()
+
+			var delays []time.Duration
+			rt := &retryTransport{
+				next:       http.DefaultTransport,
+				maxRetries: 2,
+				baseDelay:  2 * time.Second,
+				maxDelay:   time.Minute,
+				// Without jitter the backoff is half of the exponential delay
+				jitter: func(time.Duration) time.Duration { return 0 },
+				sleep: func(_ context.Context, d time.Duration) error {
+					delays = append(delays, d)
+					return nil
+				},
+			}
+			if tc.maxRetries > 0 {
+				rt.maxRetries = tc.maxRetries
+			}
+
+			ctx := context.Background()
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+
+			resp, err := rt.RoundTrip(req)
+			status := 0
+			if resp != nil {
+				status = resp.StatusCode
+				_ = resp.Body.Close()
+			}
+
+			if diff := cmp.Diff(tc.want.status, status); diff != "" {
+				t.Errorf("%s\nRoundTrip(...): -want status, +got status:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.requests, requests); diff != "" {
+				t.Errorf("%s\nRoundTrip(...): -want requests, +got requests:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.delays, delays); diff != "" {
+				t.Errorf("%s\nRoundTrip(...): -want delays, +got delays:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(errString(tc.want.err), errString(err)); diff != "" {
+				t.Errorf("%s\nRoundTrip(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+			var throttled *throttledError
+			if tc.want.err != nil && !errors.As(err, &throttled) {
+				t.Errorf("%s\nRoundTrip(...): want a *throttledError, got %T", tc.reason, err)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	cases := map[string]struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		"Empty":   {value: "", ok: false},
+		"Seconds": {value: "7", want: 7 * time.Second, ok: true},
+		"Past":    {value: "Mon, 02 Jan 2006 15:04:05 GMT", want: 0, ok: true},
+		"Invalid": {value: "soon", ok: false},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, ok := retryAfter(tc.value)
+			if got != tc.want || ok != tc.ok {
+				t.Errorf("retryAfter(%q): want (%v, %t), got (%v, %t)", tc.value, tc.want, tc.ok, got, ok)
+			}
+		})
+	}
+}
+
+// newRetryingGraphClient returns a Microsoft Graph client with the HTTP client
+// the function uses, sending its requests to srv without waiting between retries
+func newRetryingGraphClient(t *testing.T, srv *httptest.Server) *msgraphsdk.GraphServiceClient {
+	t.Helper()
+
+	httpClient := newGraphHTTPClient()
+	rt, ok := httpClient.Transport.(*retryTransport)
+	if !ok {
+		t.Fatalf("newGraphHTTPClient(): want a *retryTransport, got %T", httpClient.Transport)
+	}
+	rt.sleep = func(context.Context, time.Duration) error { return nil }
+
+	adapter, err := msgraphsdk.NewGraphRequestAdapterWithParseNodeFactoryAndSerializationWriterFactoryAndHttpClient(
+		&authentication.AnonymousAuthenticationProvider{}, nil, nil, httpClient)
+	if err != nil {
+		t.Fatalf("NewGraphRequestAdapter(...): unexpected error: %v", err)
+	}
+	adapter.SetBaseUrl(srv.URL + "/v1.0")
+	return msgraphsdk.NewGraphServiceClient(adapter)
+}
+
+func TestGraphClientThrottled(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	req := &fnv1.RunFunctionRequest{
+		Input: resource.MustStructJSON(`{
+			"apiVersion": "msgraph.fn.crossplane.io/v1alpha1",
+			"kind": "Input",
+			"queryType": "UserValidation",
+			"users": ["user@example.com"],
+			"target": "status.validatedUsers"
+		}`),
+		Observed: &fnv1.State{
+			Composite: &fnv1.Resource{
+				Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"XR","metadata":{"name":"cool-xr"}}`),
+			},
+		},
+		Credentials: map[string]*fnv1.Credentials{
+			"azure-creds": {
+				Source: &fnv1.Credentials_CredentialData{CredentialData: &fnv1.CredentialData{
+					Data: map[string][]byte{
+						"credentials": []byte(`{"clientId": "client", "clientSecret": "secret", "tenantId": "tenant"}`),
+					},
+				}},
+			},
+		},
+	}
+	azureCreds, err := getCreds(req)
+	if err != nil {
+		t.Fatalf("getCreds(...): unexpected error: %v", err)
+	}
+
+	g := &GraphQuery{}
+	g.clients.add(graphClientCacheKey(azureCreds), newRetryingGraphClient(t, srv))
+
+	// The throttledError should survive the request adapter and the query
+	_, err = g.graphQuery(context.Background(), azureCreds, &v1beta1.Input{
+		QueryType: "UserValidation",
+		Users:     []*string{strPtr("user@example.com")},
+	})
+	var throttled *throttledError
+	if !errors.As(err, &throttled) {
+		t.Fatalf("graphQuery(...): want a *throttledError, got %T: %v", err, err)
+	}
+	if diff := cmp.Diff(int32(defaultMaxRetries+1), atomic.LoadInt32(&requests)); diff != "" {
+		t.Errorf("graphQuery(...): the request should be retried until the retries are exhausted: -want requests, +got requests:\n%s", diff)
+	}
+
+	// RunFunction should report throttling rather than fail
+	f := &Function{graphQuery: g, log: logging.NewNopLogger()}
+	rsp, err := f.RunFunction(context.Background(), req)
+	if err != nil {
+		t.Fatalf("RunFunction(...): unexpected error: %v", err)
+	}
+	for _, r := range rsp.GetResults() {
+		if r.GetSeverity() == fnv1.Severity_SEVERITY_FATAL {
+			t.Errorf("RunFunction(...): a throttled query should not return a fatal result, got %q", r.GetMessage())
+		}
+	}
+	var reasons []string
+	for _, c := range rsp.GetConditions() {
+		reasons = append(reasons, c.GetReason())
+	}
+	if diff := cmp.Diff([]string{"Throttled"}, reasons); diff != "" {
+		t.Errorf("RunFunction(...): -want condition reasons, +got condition reasons:\n%s", diff)
+	}
+}
+
+func TestGraphClientRetryReplaysBody(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		bodies []interface{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1.0/users":
+			_, _ = w.Write([]byte(`{"value": [{"id": "user-1"}]}`))
+		case "/v1.0/groups":
+			_, _ = w.Write([]byte(`{"value": [{"id": "group-1"}]}`))
+		case "/v1.0/users/user-1/checkMemberGroups":
+			var reader io.Reader = r.Body
+			if r.Header.Get("Content-Encoding") == "gzip" {
+				gz, err := gzip.NewReader(r.Body)
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				reader = gz
+			}
+			var body interface{}
+			if err := json.NewDecoder(reader).Decode(&body); err != nil {
+				body = err.Error()
+			}
+
+			mu.Lock()
+			bodies = append(bodies, body)
+			first := len(bodies) == 1
+			mu.Unlock()
+
+			// Throttle the first attempt only
+			if first {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			_, _ = w.Write([]byte(`{"value": ["group-1"]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	g := &GraphQuery{}
+	results, err := g.checkMembership(context.Background(), newRetryingGraphClient(t, srv), &v1beta1.Input{
+		QueryType: "CheckMembership",
+		Principal: strPtr("user1@example.com"),
+		Groups:    []*string{strPtr("Developers")},
+	})
+	if err != nil {
+		t.Fatalf("checkMembership(...): unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(map[string]interface{}{"Developers": true}, results); diff != "" {
+		t.Errorf("checkMembership(...): -want, +got:\n%s", diff)
+	}
+
+	body := map[string]interface{}{"groupIds": []interface{}{"group-1"}}
+	if diff := cmp.Diff([]interface{}{body, body}, bodies); diff != "" {
+		t.Errorf("checkMembership(...): the POST body should be sent again on retry: -want bodies, +got bodies:\n%s", diff)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/upbound/function-msgraph/input/v1beta1"
+)
+
+// defaultSelectFields lists, for each query type that supports select, the
+// properties returned if the input selects none
+var defaultSelectFields = map[string][]string{
+	"UserValidation":          {"id", "displayName", "userPrincipalName", "mail"},
+	"GroupObjectIDs":          {"id", "displayName", "description"},
+	"ServicePrincipalDetails": {"id", "appId", "displayName", "description"},
+}
+
+// selectPropertyRegex matches a property name, including the names of
+// directory extensions such as extension_<appId>_costCenter
+var selectPropertyRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// isValidSelect checks if every selected property is a property name, and
+// returns the first one that is not
+func isValidSelect(fields []string) (string, bool) {
+	for _, field := range fields {
+		if !selectPropertyRegex.MatchString(field) {
+			return field, false
+		}
+	}
+	return "", true
+}
+
+// selectedFields returns the properties selected for the query. The id, and the
+// properties names are looked up by, are always selected, so that results can
+// be matched against the requested names.
+func selectedFields(in *v1beta1.Input) []string {
+	if len(in.Select) == 0 {
+		return defaultSelectFields[in.QueryType]
+	}
+
+	fields := append([]string{}, in.Select...)
+	for _, property := range lookupProperties[in.QueryType] {
+		if !containsFold(fields, property) {
+			fields = append(fields, property)
+		}
+	}
+	return fields
+}
+
+// containsFold checks if the list contains the value, ignoring case
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/upbound/function-msgraph/input/v1beta1"
+)
+
+func TestSelectedFields(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		in     *v1beta1.Input
+		want   []string
+	}{
+		"DefaultUserFields": {
+			reason: "Users should be returned with the standard fields if none are selected",
+			in:     &v1beta1.Input{QueryType: "UserValidation"},
+			want:   []string{"id", "displayName", "userPrincipalName", "mail"},
+		},
+		"SelectedUserFields": {
+			reason: "The user principal name and id should always be selected, so that users can be matched",
+			in:     &v1beta1.Input{QueryType: "UserValidation", Select: []string{"department", "jobTitle"}},
+			want:   []string{"department", "jobTitle", "userPrincipalName", "id"},
+		},
+		"SelectedServicePrincipalFields": {
+			reason: "Lookup properties that were already selected, in any case, should not be selected twice",
+			in:     &v1beta1.Input{QueryType: "ServicePrincipalDetails", Select: []string{"ID", "appId", "tags"}},
+			want:   []string{"ID", "appId", "tags", "displayName"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := selectedFields(tc.in)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nselectedFields(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestIsValidSelect(t *testing.T) {
+	cases := map[string]struct {
+		reason  string
+		fields  []string
+		invalid string
+		want    bool
+	}{
+		"Properties": {
+			reason: "Property names should be valid",
+			fields: []string{"id", "onPremisesSyncEnabled"},
+			want:   true,
+		},
+		"Extension": {
+			reason: "Directory extension property names should be valid",
+			fields: []string{"extension_0123456789abcdef0123456789abcdef_costCenter"},
+			want:   true,
+		},
+		"QueryOption": {
+			reason:  "A name adding another query option should be invalid",
+			fields:  []string{"id", "id&$filter=id ne null"},
+			invalid: "id&$filter=id ne null",
+		},
+		"Empty": {
+			reason:  "An empty name should be invalid",
+			fields:  []string{""},
+			invalid: "",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			invalid, got := isValidSelect(tc.fields)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nisValidSelect(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.invalid, invalid); diff != "" {
+				t.Errorf("%s\nisValidSelect(...): -want invalid, +got invalid:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestValidateUsersSelect(t *testing.T) {
+	client := newFakeGraphClient(t, map[string]string{
+		"/v1.0/users?$filter=userPrincipalName eq 'user1@example.com'": `{"value": [{
+			"id": "user-1",
+			"userPrincipalName": "user1@example.com",
+			"department": "Engineering",
+			"accountEnabled": true,
+			"onPremisesSyncEnabled": null,
+			"employeeHireDate": "2024-01-15T00:00:00Z",
+			"assignedLicenses": [{"skuId": "00000000-0000-0000-0000-000000000001", "disabledPlans": []}],
+			"extension_0123456789abcdef0123456789abcdef_costCenter": "CC-1"
+		}]}`,
+	})
+
+	g := &GraphQuery{}
+	results, err := g.validateUsers(context.Background(), client, &v1beta1.Input{
+		QueryType: "UserValidation",
+		Users:     []*string{strPtr("user1@example.com")},
+		Select: []string{
+			"department",
+			"AccountEnabled",
+			"onPremisesSyncEnabled",
+			"employeeHireDate",
+			"assignedLicenses",
+			"extension_0123456789abcdef0123456789abcdef_costCenter",
+			"jobTitle",
+		},
+	})
+	if err != nil {
+		t.Fatalf("validateUsers(...): unexpected error: %v", err)
+	}
+
+	want := []interface{}{
+		map[string]interface{}{
+			"id":                    "user-1",
+			"userPrincipalName":     "user1@example.com",
+			"department":            "Engineering",
+			"accountEnabled":        true,
+			"onPremisesSyncEnabled": nil,
+			"employeeHireDate":      "2024-01-15T00:00:00Z",
+			"assignedLicenses": []interface{}{
+				map[string]interface{}{"skuId": "00000000-0000-0000-0000-000000000001", "disabledPlans": []interface{}{}},
+			},
+			"extension_0123456789abcdef0123456789abcdef_costCenter": "CC-1",
+			"jobTitle": nil,
+		},
+	}
+	if diff := cmp.Diff(want, results); diff != "" {
+		t.Errorf("validateUsers(...): -want, +got:\n%s", diff)
+	}
+}
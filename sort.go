@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/upbound/function-msgraph/input/v1beta1"
+)
+
+// defaultSortBy is the property results are sorted by if the input sets no sortBy
+const defaultSortBy = "id"
+
+// sortProperty returns the property to sort the results of the input by
+func sortProperty(in *v1beta1.Input) string {
+	if in.SortBy != nil && *in.SortBy != "" {
+		return *in.SortBy
+	}
+	return defaultSortBy
+}
+
+// sortedNestedLists lists, for each query type, the lists of objects held by
+// its results that are sorted too
+var sortedNestedLists = map[string][]string{
+	"GroupOwners":  {"owners"},
+	"UserMemberOf": {"groups", "directoryRoles"},
+}
+
+// sortResults returns a copy of the results sorted by the sortBy property of the
+// input, so that they are stored in the same order whatever order Microsoft
+// Graph returned them in. The owners of GroupOwners results, and the groups and
+// directory roles of UserMemberOf results, are sorted too. Custom queries with
+// orderBy keep their order unless sortBy is set.
+func sortResults(in *v1beta1.Input, results interface{}) interface{} {
+	if in.QueryType == "Custom" && len(in.OrderBy) > 0 && (in.SortBy == nil || *in.SortBy == "") {
+		return results
+	}
+	property := sortProperty(in)
+	nested := sortedNestedLists[in.QueryType]
+
+	switch r := results.(type) {
+	case []interface{}:
+		sorted := sortedList(r, property)
+		for i, result := range sorted {
+			sorted[i] = sortNestedLists(result, nested, property)
+		}
+		return sorted
+	case map[string]interface{}:
+		// Results keyed by name are stored in key order, only their lists are sorted
+		if len(nested) == 0 {
+			return results
+		}
+		sorted := make(map[string]interface{}, len(r))
+		for name, result := range r {
+			sorted[name] = sortNestedLists(result, nested, property)
+		}
+		return sorted
+	}
+	return results
+}
+
+// sortNestedLists returns a copy of a result with the given lists of objects it
+// holds sorted by a property
+func sortNestedLists(result interface{}, lists []string, property string) interface{} {
+	m, ok := result.(map[string]interface{})
+	if !ok || len(lists) == 0 {
+		return result
+	}
+	copied := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		copied[key] = value
+	}
+	for _, key := range lists {
+		if list, ok := copied[key].([]interface{}); ok {
+			copied[key] = sortedList(list, property)
+		}
+	}
+	return copied
+}
+
+// sortedList returns a copy of a list of results sorted by a property. Results
+// sharing a value are sorted by id, and results without the property come last.
+func sortedList(list []interface{}, property string) []interface{} {
+	if list == nil {
+		return nil
+	}
+	sorted := append(make([]interface{}, 0, len(list)), list...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if c := compareResults(sorted[i], sorted[j], property); c != 0 {
+			return c < 0
+		}
+		return compareResults(sorted[i], sorted[j], defaultSortBy) < 0
+	})
+	return sorted
+}
+
+// compareResults compares the values two results hold for a property, a result
+// without the property sorts after one with it
+func compareResults(a, b interface{}, property string) int {
+	av, aok := sortValue(a, property)
+	bv, bok := sortValue(b, property)
+	switch {
+	case !aok && !bok:
+		return 0
+	case !aok:
+		return 1
+	case !bok:
+		return -1
+	}
+
+	// Numbers are compared by value, anything else by its string form
+	if an, ok := sortNumber(av); ok {
+		if bn, ok := sortNumber(bv); ok {
+			switch {
+			case an < bn:
+				return -1
+			case an > bn:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(fmt.Sprint(av), fmt.Sprint(bv))
+}
+
+// sortValue returns the value a result holds for a property, matched
+// case-insensitively as properties are selected, following pointers
+func sortValue(result interface{}, property string) (interface{}, bool) {
+	m, ok := result.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	value, ok := m[property]
+	if !ok {
+		for key, v := range m {
+			if strings.EqualFold(key, property) {
+				value, ok = v, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil, false
+	}
+
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil, false
+	}
+	return v.Interface(), true
+}
+
+// sortNumber returns the value of a number as a float64
+func sortNumber(value interface{}) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/upbound/function-msgraph/input/v1beta1"
+)
+
+func TestSortResults(t *testing.T) {
+	cases := map[string]struct {
+		reason  string
+		in      *v1beta1.Input
+		results interface{}
+		want    interface{}
+	}{
+		"DefaultByID": {
+			reason: "Results should be sorted by id by default, including ids held by pointers",
+			in:     &v1beta1.Input{QueryType: "GroupMembership"},
+			results: []interface{}{
+				map[string]interface{}{"id": strPtr("user-2")},
+				map[string]interface{}{"id": strPtr("sp-1")},
+				map[string]interface{}{"id": strPtr("user-1")},
+			},
+			want: []interface{}{
+				map[string]interface{}{"id": strPtr("sp-1")},
+				map[string]interface{}{"id": strPtr("user-1")},
+				map[string]interface{}{"id": strPtr("user-2")},
+			},
+		},
+		"SortBy": {
+			reason: "Results should be sorted by sortBy, and results sharing a value by id",
+			in:     &v1beta1.Input{QueryType: "ServicePrincipalDetails", SortBy: strPtr("displayName")},
+			results: []interface{}{
+				map[string]interface{}{"id": "sp-3", "displayName": "web"},
+				map[string]interface{}{"id": "sp-2", "displayName": "api"},
+				map[string]interface{}{"id": "sp-1", "displayName": "api"},
+			},
+			want: []interface{}{
+				map[string]interface{}{"id": "sp-1", "displayName": "api"},
+				map[string]interface{}{"id": "sp-2", "displayName": "api"},
+				map[string]interface{}{"id": "sp-3", "displayName": "web"},
+			},
+		},
+		"MissingLast": {
+			reason: "Results without the sortBy property should come last",
+			in:     &v1beta1.Input{QueryType: "UserValidation", SortBy: strPtr("department")},
+			results: []interface{}{
+				map[string]interface{}{"id": "user-1", "department": nil},
+				map[string]interface{}{"id": "user-2", "department": "Engineering"},
+			},
+			want: []interface{}{
+				map[string]interface{}{"id": "user-2", "department": "Engineering"},
+				map[string]interface{}{"id": "user-1", "department": nil},
+			},
+		},
+		"Numbers": {
+			reason: "Numbers should be sorted by value",
+			in:     &v1beta1.Input{QueryType: "Custom", Path: strPtr("/groups"), SortBy: strPtr("size")},
+			results: []interface{}{
+				map[string]interface{}{"id": "group-1", "size": float64(10)},
+				map[string]interface{}{"id": "group-2", "size": float64(9)},
+			},
+			want: []interface{}{
+				map[string]interface{}{"id": "group-2", "size": float64(9)},
+				map[string]interface{}{"id": "group-1", "size": float64(10)},
+			},
+		},
+		"CustomOrderBy": {
+			reason: "Custom results ordered with orderBy should keep their order",
+			in:     &v1beta1.Input{QueryType: "Custom", Path: strPtr("/groups"), OrderBy: []string{"displayName desc"}},
+			results: []interface{}{
+				map[string]interface{}{"id": "group-1", "displayName": "web"},
+				map[string]interface{}{"id": "group-2", "displayName": "api"},
+			},
+			want: []interface{}{
+				map[string]interface{}{"id": "group-1", "displayName": "web"},
+				map[string]interface{}{"id": "group-2", "displayName": "api"},
+			},
+		},
+		"GroupOwners": {
+			reason: "The owners of each group should be sorted too",
+			in:     &v1beta1.Input{QueryType: "GroupOwners"},
+			results: []interface{}{
+				map[string]interface{}{"id": "group-2", "owners": []interface{}{
+					map[string]interface{}{"id": "user-2"},
+					map[string]interface{}{"id": "user-1"},
+				}},
+				map[string]interface{}{"id": "group-1", "owners": []interface{}{}},
+			},
+			want: []interface{}{
+				map[string]interface{}{"id": "group-1", "owners": []interface{}{}},
+				map[string]interface{}{"id": "group-2", "owners": []interface{}{
+					map[string]interface{}{"id": "user-1"},
+					map[string]interface{}{"id": "user-2"},
+				}},
+			},
+		},
+		"KeyedByName": {
+			reason: "Results keyed by name should only have their lists sorted",
+			in:     &v1beta1.Input{QueryType: "UserMemberOf"},
+			results: map[string]interface{}{
+				"user1@example.com": map[string]interface{}{
+					"id": "user-1",
+					"groups": []interface{}{
+						map[string]interface{}{"id": "group-2"},
+						map[string]interface{}{"id": "group-1"},
+					},
+					"directoryRoles": []interface{}{},
+				},
+			},
+			want: map[string]interface{}{
+				"user1@example.com": map[string]interface{}{
+					"id": "user-1",
+					"groups": []interface{}{
+						map[string]interface{}{"id": "group-1"},
+						map[string]interface{}{"id": "group-2"},
+					},
+					"directoryRoles": []interface{}{},
+				},
+			},
+		},
+		"NotAList": {
+			reason:  "Results that are not a list should be returned as is",
+			in:      &v1beta1.Input{QueryType: "CheckMembership"},
+			results: map[string]interface{}{"Developers": true, "Operations": false},
+			want:    map[string]interface{}{"Developers": true, "Operations": false},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := sortResults(tc.in, tc.results)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nsortResults(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestSortResultsShuffled(t *testing.T) {
+	group := `{"value": [{"id": "group-1", "displayName": "Developers"}]}`
+	user1 := `{"@odata.type": "#microsoft.graph.user", "id": "user-1", "displayName": "User 1"}`
+	user2 := `{"@odata.type": "#microsoft.graph.user", "id": "user-2", "displayName": "User 2"}`
+	sp1 := `{"@odata.type": "#microsoft.graph.servicePrincipal", "id": "sp-1", "displayName": "SP 1", "appId": "app-1"}`
+	sp2 := `{"@odata.type": "#microsoft.graph.servicePrincipal", "id": "sp-2", "displayName": "SP 2", "appId": "app-2"}`
+
+	// The same members, returned in a different order and split across pages differently
+	responses := map[string]map[string]string{
+		"Ordered": {
+			"/v1.0/groups?$filter=displayName eq 'Developers'":    group,
+			"/v1.0/groups/group-1/members":                        `{"value": [` + sp1 + `, ` + user1 + `, ` + user2 + `]}`,
+			"/v1.0/groups/group-1/members/graph.servicePrincipal": `{"value": [` + sp1 + `, ` + sp2 + `]}`,
+		},
+		"Shuffled": {
+			"/v1.0/groups?$filter=displayName eq 'Developers'": group,
+			"/v1.0/groups/group-1/members": `{
+				"value": [` + user2 + `, ` + sp2 + `],
+				"@odata.nextLink": "{{server}}/v1.0/groups/group-1/members?$skiptoken=page-2"
+			}`,
+			"/v1.0/groups/group-1/members?$skiptoken=page-2":      `{"value": [` + user1 + `]}`,
+			"/v1.0/groups/group-1/members/graph.servicePrincipal": `{"value": [` + sp2 + `, ` + sp1 + `]}`,
+		},
+	}
+
+	want := []string{"sp-1", "sp-2", "user-1", "user-2"}
+	in := &v1beta1.Input{QueryType: "GroupMembership", Group: strPtr("Developers")}
+
+	var first interface{}
+	for name, bodies := range responses {
+		t.Run(name, func(t *testing.T) {
+			client := newFakeGraphClient(t, bodies)
+			g := &GraphQuery{}
+
+			results, err := g.getGroupMembers(context.Background(), client, in)
+			if err != nil {
+				t.Fatalf("getGroupMembers(...): unexpected error: %v", err)
+			}
+			sorted := sortResults(in, results)
+
+			var got []string
+			for _, result := range sorted.([]interface{}) {
+				id, _ := stringValue(result.(map[string]interface{})["id"])
+				got = append(got, id)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("sortResults(...): members should be sorted by id whatever order they were returned in: -want, +got:\n%s", diff)
+			}
+
+			if first == nil {
+				first = sorted
+				return
+			}
+			if diff := cmp.Diff(first, sorted); diff != "" {
+				t.Errorf("sortResults(...): members returned in another order should be stored identically: -first, +got:\n%s", diff)
+			}
+		})
+	}
+}
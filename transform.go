@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+)
+
+// transformCostLimit bounds the work a transform expression may do, so that a
+// runaway expression cannot stall the function
+const transformCostLimit = 10000000
+
+// compileTransform compiles a transform expression over the query results,
+// reporting each compilation error with its line and column
+func compileTransform(expression string) (cel.Program, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("results", cel.DynType),
+		ext.Strings(),
+		ext.Lists(),
+		ext.TwoVarComprehensions(),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create transform environment")
+	}
+
+	ast, iss := env.Compile(expression)
+	if iss.Err() != nil {
+		issues := make([]string, 0, len(iss.Errors()))
+		for _, e := range iss.Errors() {
+			issues = append(issues, fmt.Sprintf("%d:%d: %s", e.Location.Line(), e.Location.Column()+1, e.Message))
+		}
+		return nil, errors.Errorf("cannot compile transform: %s", strings.Join(issues, "; "))
+	}
+
+	program, err := env.Program(ast, cel.CostLimit(transformCostLimit))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot compile transform")
+	}
+	return program, nil
+}
+
+// transformResults evaluates a transform expression over the query results,
+// which it refers to as results, and returns the value it evaluates to
+func transformResults(expression string, results interface{}) (interface{}, error) {
+	program, err := compileTransform(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	// Results hold plain values or pointers to them, JSON reduces them to plain values
+	data, err := json.Marshal(results)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot convert results for transform")
+	}
+	var input interface{}
+	if err := json.Unmarshal(data, &input); err != nil {
+		return nil, errors.Wrap(err, "cannot convert results for transform")
+	}
+
+	out, _, err := program.Eval(map[string]interface{}{"results": input})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot evaluate transform")
+	}
+
+	value, err := out.ConvertToNative(reflect.TypeOf(&structpb.Value{}))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot convert transform result")
+	}
+	return value.(*structpb.Value).AsInterface(), nil
+}
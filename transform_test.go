@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTransformResults(t *testing.T) {
+	results := []interface{}{
+		map[string]interface{}{"id": "group-1", "displayName": "admins"},
+		map[string]interface{}{"id": "group-2", "displayName": strPtr("operators")},
+	}
+
+	type want struct {
+		results interface{}
+		err     string
+	}
+
+	cases := map[string]struct {
+		reason     string
+		expression string
+		want       want
+	}{
+		"Map": {
+			reason:     "A transform should be able to reduce results to their IDs",
+			expression: "results.map(g, g.id)",
+			want:       want{results: []interface{}{"group-1", "group-2"}},
+		},
+		"MapByName": {
+			reason:     "A transform should be able to key results by name, including values held by pointers",
+			expression: "results.transformMapEntry(i, g, {g.displayName: g.id})",
+			want: want{results: map[string]interface{}{
+				"admins":    "group-1",
+				"operators": "group-2",
+			}},
+		},
+		"Value": {
+			reason:     "A transform should be able to return a single value",
+			expression: "size(results)",
+			want:       want{results: float64(2)},
+		},
+		"CompileError": {
+			reason:     "A transform that does not compile should report the position of the error",
+			expression: "foo.map(g, g.id)",
+			want:       want{err: "cannot compile transform: 1:1: undeclared reference to 'foo' (in container '')"},
+		},
+		"EvaluationError": {
+			reason:     "A transform that fails to evaluate should return an error",
+			expression: "results.map(g, g.owner)",
+			want:       want{err: "cannot evaluate transform: no such key: owner"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := transformResults(tc.expression, results)
+
+			if diff := cmp.Diff(tc.want.err, errString(err)); diff != "" {
+				t.Fatalf("%s\ntransformResults(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.results, got); diff != "" {
+				t.Errorf("%s\ntransformResults(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionTransform(t *testing.T) {
+	groups := []interface{}{
+		map[string]interface{}{"id": "group-1", "displayName": "platform-operators"},
+		map[string]interface{}{"id": "group-2", "displayName": "platform-admins"},
+	}
+
+	type want struct {
+		value string
+		fatal string
+	}
+
+	cases := map[string]struct {
+		reason string
+		input  string
+		want   want
+	}{
+		"StatusTarget": {
+			reason: "The transformed results should be stored in a status target",
+			input:  `{"queryType": "GroupObjectIDs", "groups": ["platform-operators", "platform-admins"], "transform": "results.map(g, g.displayName)", "target": "status.groupNames"}`,
+			want:   want{value: `["platform-operators", "platform-admins"]`},
+		},
+		"ContextTarget": {
+			reason: "The transformed results should be stored in a context target",
+			input:  `{"queryType": "GroupObjectIDs", "groups": ["platform-operators", "platform-admins"], "transform": "size(results)", "target": "context.groupCount"}`,
+			want:   want{value: `2`},
+		},
+		"SortFormatTransform": {
+			reason: "Results should be sorted, then shaped as the output format says, then transformed",
+			input:  `{"queryType": "GroupObjectIDs", "groups": ["platform-operators", "platform-admins"], "sortBy": "displayName", "outputFormat": "IDsOnly", "transform": "results.map(id, 'groups/' + id)", "target": "status.groupPaths"}`,
+			want:   want{value: `["groups/group-2", "groups/group-1"]`},
+		},
+		"FormatTransform": {
+			reason: "A transform should see the results keyed as the output format says",
+			input:  `{"queryType": "GroupObjectIDs", "groups": ["platform-operators", "platform-admins"], "outputFormat": "MapByName", "transform": "results.transformMapEntry(name, g, {name: g.id})", "target": "status.groupIDs"}`,
+			want: want{value: `{
+				"platform-admins": "group-2",
+				"platform-operators": "group-1"
+			}`},
+		},
+		"CompileError": {
+			reason: "A transform that does not compile should return a fatal result with the position of the error",
+			input:  `{"queryType": "GroupObjectIDs", "groups": ["platform-operators"], "transform": "foo.map(g, g.id)", "target": "status.groupIDs"}`,
+			want:   want{fatal: "cannot compile transform: 1:1: undeclared reference to 'foo' (in container '')"},
+		},
+		"EvaluationError": {
+			reason: "A transform that fails to evaluate should return a fatal result",
+			input:  `{"queryType": "GroupObjectIDs", "groups": ["platform-operators"], "transform": "results.map(g, g.owner)", "target": "status.groupIDs"}`,
+			want:   want{fatal: "cannot evaluate transform: no such key: owner"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			value, fatal := runFunctionWithResults(t, tc.input, groups)
+
+			if diff := cmp.Diff(tc.want.fatal, fatal); diff != "" {
+				t.Fatalf("%s\nf.RunFunction(...): -want fatal, +got fatal:\n%s", tc.reason, diff)
+			}
+			if tc.want.fatal != "" {
+				return
+			}
+			var want interface{}
+			if err := json.Unmarshal([]byte(tc.want.value), &want); err != nil {
+				t.Fatalf("json.Unmarshal(...): %v", err)
+			}
+			if diff := cmp.Diff(want, value); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want target, +got target:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/upbound/function-msgraph/input/v1beta1"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/response"
+)
+
+const (
+	// onMissingFail fails the function if a requested identity was not found
+	onMissingFail = "Fail"
+	// onMissingWarn returns a warning if a requested identity was not found
+	onMissingWarn = "Warn"
+	// onMissingIgnore silently returns the identities that were found
+	onMissingIgnore = "Ignore"
+)
+
+// isValidOnMissing checks if the onMissing mode is supported, an empty mode defaults to Ignore
+func isValidOnMissing(onMissing string) bool {
+	switch onMissing {
+	case "", onMissingFail, onMissingWarn, onMissingIgnore:
+		return true
+	}
+	return false
+}
+
+// checkMissing compares the requested identities against the query results and
+// handles the missing ones as the onMissing mode of the input says. It returns
+// false if the function should stop because identities are missing.
+func (f *Function) checkMissing(in *v1beta1.Input, results interface{}, rsp *fnv1.RunFunctionResponse) bool {
+	if in.OnMissing == "" || in.OnMissing == onMissingIgnore {
+		return true
+	}
+
+	missing, unqueried := missingNames(in, results)
+	if len(unqueried) > 0 {
+		// Names never looked up are not known to be missing
+		response.Warning(rsp, errors.Errorf("%s results were truncated to maxResults (%d), these were not looked up: %s",
+			in.QueryType, int(newResultLimit(in)), strings.Join(unqueried, ", ")))
+		f.log.Info("WARNING: ", "notLookedUp", unqueried)
+	}
+	if len(missing) == 0 {
+		return true
+	}
+
+	err := errors.Errorf("%s found no match for: %s", in.QueryType, strings.Join(missing, ", "))
+	switch in.OnMissing {
+	case onMissingFail:
+		response.ConditionFalse(rsp, "FunctionSuccess", "ValidationFailed").
+			WithMessage(err.Error()).
+			TargetCompositeAndClaim()
+		response.Fatal(rsp, err)
+		f.log.Info("VALIDATION FAILED: ", "missing", missing)
+		return false
+	case onMissingWarn:
+		response.Warning(rsp, err)
+		f.log.Info("WARNING: ", "missing", missing)
+	}
+	return true
+}
+
+// missingNames returns the requested names that none of the query results
+// match, in the order they were requested. Names are matched case-insensitively,
+// as Microsoft Graph does. Queries that reach maxResults stop looking up names,
+// the names requested after the last one matched were never looked up, and are
+// returned apart as unqueried rather than as missing.
+func missingNames(in *v1beta1.Input, results interface{}) (missing, unqueried []string) {
+	var fields []string
+	switch in.QueryType {
+	case "UserValidation", "UserMemberOf":
+		fields = []string{lookupByUserPrincipalName}
+	case "GroupObjectIDs", "ServicePrincipalDetails":
+		fields = []string{lookupByDisplayName}
+	case "ApplicationDetails":
+		fields = []string{lookupByDisplayName, lookupByAppID}
+	default:
+		return nil, nil
+	}
+	requested := requestedNames(in)
+
+	// Names looked up by another property are matched against that property
+	if in.LookupBy != "" {
+		fields = []string{in.LookupBy}
+	}
+
+	// Results keyed by name, such as those of UserMemberOf, are matched by their values
+	items, _ := results.([]interface{})
+	if byName, ok := results.(map[string]interface{}); ok {
+		for _, item := range byName {
+			items = append(items, item)
+		}
+	}
+
+	found := make(map[string]bool)
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, field := range fields {
+			if name, ok := stringValue(m[field]); ok {
+				found[strings.ToLower(name)] = true
+			}
+		}
+	}
+
+	// UserMemberOf looks up every user, the other queries stop at the first
+	// name whose results reach maxResults
+	lastLookedUp := len(requested) - 1
+	if in.QueryType != "UserMemberOf" && newResultLimit(in).reached(len(items)) {
+		lastLookedUp = lastMatched(requested, found)
+	}
+
+	for i, name := range requested {
+		if name == nil || found[strings.ToLower(*name)] {
+			continue
+		}
+		if i > lastLookedUp {
+			unqueried = append(unqueried, *name)
+			continue
+		}
+		missing = append(missing, *name)
+	}
+	return missing, unqueried
+}
+
+// requestedNames returns the names the query of the input looks up
+func requestedNames(in *v1beta1.Input) []*string {
+	switch in.QueryType {
+	case "UserValidation", "UserMemberOf":
+		return in.Users
+	case "GroupObjectIDs":
+		return in.Groups
+	case "ServicePrincipalDetails":
+		return in.ServicePrincipals
+	case "ApplicationDetails":
+		return in.Applications
+	}
+	return nil
+}
+
+// lastMatched returns the index of the last requested name that was found. A
+// name requested more than once counts at its first index, as only that one
+// was looked up before the lookups stopped.
+func lastMatched(requested []*string, found map[string]bool) int {
+	last := -1
+	first := make(map[string]bool)
+	for i, name := range requested {
+		if name == nil {
+			continue
+		}
+		key := strings.ToLower(*name)
+		if first[key] {
+			continue
+		}
+		first[key] = true
+		if found[key] {
+			last = i
+		}
+	}
+	return last
+}
+
+// stringValue returns the string, or the string pointed to, held by a result field
+func stringValue(v interface{}) (string, bool) {
+	switch s := v.(type) {
+	case string:
+		return s, true
+	case *string:
+		if s != nil {
+			return *s, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/upbound/function-msgraph/input/v1beta1"
+)
+
+func TestMissingNames(t *testing.T) {
+	type want struct {
+		missing   []string
+		unqueried []string
+	}
+
+	cases := map[string]struct {
+		reason  string
+		in      *v1beta1.Input
+		results interface{}
+		want    want
+	}{
+		"AllFound": {
+			reason: "No names should be missing if every requested user was returned",
+			in: &v1beta1.Input{
+				QueryType: "UserValidation",
+				Users:     []*string{strPtr("a@example.com"), strPtr("B@Example.com")},
+			},
+			results: []interface{}{
+				map[string]interface{}{"userPrincipalName": strPtr("a@example.com")},
+				map[string]interface{}{"userPrincipalName": strPtr("b@example.com")},
+			},
+		},
+		"UsersMissing": {
+			reason: "Requested users that were not returned should be missing, in the order requested",
+			in: &v1beta1.Input{
+				QueryType: "UserValidation",
+				Users:     []*string{strPtr("c@example.com"), strPtr("a@example.com"), strPtr("b@example.com")},
+			},
+			results: []interface{}{
+				map[string]interface{}{"userPrincipalName": strPtr("a@example.com")},
+			},
+			want: want{missing: []string{"c@example.com", "b@example.com"}},
+		},
+		"CachedGroups": {
+			reason: "Groups should be matched by display name in results read back from the cache",
+			in: &v1beta1.Input{
+				QueryType: "GroupObjectIDs",
+				Groups:    []*string{strPtr("Developers"), strPtr("Operations")},
+			},
+			results: []interface{}{
+				map[string]interface{}{"displayName": "Developers"},
+			},
+			want: want{missing: []string{"Operations"}},
+		},
+		"NoResults": {
+			reason: "Every requested service principal should be missing if none were returned",
+			in: &v1beta1.Input{
+				QueryType:         "ServicePrincipalDetails",
+				ServicePrincipals: []*string{strPtr("MyServiceApp")},
+			},
+			results: []interface{}(nil),
+			want:    want{missing: []string{"MyServiceApp"}},
+		},
+		"ApplicationsByNameOrAppID": {
+			reason: "Applications should be matched by either display name or app ID",
+			in: &v1beta1.Input{
+				QueryType: "ApplicationDetails",
+				Applications: []*string{
+					strPtr("My App"),
+					strPtr("00000000-0000-0000-0000-000000000001"),
+					strPtr("Other App"),
+				},
+			},
+			results: []interface{}{
+				map[string]interface{}{"displayName": "My App", "appId": "00000000-0000-0000-0000-000000000009"},
+				map[string]interface{}{"displayName": "Second App", "appId": "00000000-0000-0000-0000-000000000001"},
+			},
+			want: want{missing: []string{"Other App"}},
+		},
+		"ServicePrincipalsByAppID": {
+			reason: "Service principals looked up by app ID should be matched by app ID rather than display name",
+			in: &v1beta1.Input{
+				QueryType:         "ServicePrincipalDetails",
+				LookupBy:          "appId",
+				ServicePrincipals: []*string{strPtr("00000000-0000-0000-0000-000000000001"), strPtr("MyServiceApp")},
+			},
+			results: []interface{}{
+				map[string]interface{}{"displayName": strPtr("MyServiceApp"), "appId": strPtr("00000000-0000-0000-0000-000000000001")},
+			},
+			want: want{missing: []string{"MyServiceApp"}},
+		},
+		"UserMemberships": {
+			reason: "Users should be matched against results keyed by user principal name",
+			in: &v1beta1.Input{
+				QueryType: "UserMemberOf",
+				Users:     []*string{strPtr("a@example.com"), strPtr("b@example.com")},
+			},
+			results: map[string]interface{}{
+				"a@example.com": map[string]interface{}{"userPrincipalName": "a@example.com", "groups": []interface{}{}},
+			},
+			want: want{missing: []string{"b@example.com"}},
+		},
+		"MaxResultsReached": {
+			reason: "Names requested after the last one matched should not be missing if the results reached maxResults, as they were never looked up",
+			in: &v1beta1.Input{
+				QueryType:  "GroupObjectIDs",
+				Groups:     []*string{strPtr("Developers"), strPtr("Operations"), strPtr("Finance"), strPtr("Security")},
+				MaxResults: intPtr(1),
+			},
+			results: []interface{}{
+				map[string]interface{}{"displayName": "Finance"},
+			},
+			want: want{
+				missing:   []string{"Developers", "Operations"},
+				unqueried: []string{"Security"},
+			},
+		},
+		"MaxResultsNotReached": {
+			reason: "Every name should have been looked up if the results did not reach maxResults",
+			in: &v1beta1.Input{
+				QueryType:  "UserValidation",
+				Users:      []*string{strPtr("a@example.com"), strPtr("b@example.com")},
+				MaxResults: intPtr(2),
+			},
+			results: []interface{}{
+				map[string]interface{}{"userPrincipalName": "a@example.com"},
+			},
+			want: want{missing: []string{"b@example.com"}},
+		},
+		"MaxResultsRepeatedName": {
+			reason: "A name requested again after the lookups stopped should not move where they stopped",
+			in: &v1beta1.Input{
+				QueryType:         "ServicePrincipalDetails",
+				ServicePrincipals: []*string{strPtr("api"), strPtr("web"), strPtr("API")},
+				MaxResults:        intPtr(1),
+			},
+			results: []interface{}{
+				map[string]interface{}{"displayName": "api"},
+			},
+			want: want{unqueried: []string{"web"}},
+		},
+		"UserMembershipsMaxResults": {
+			reason: "UserMemberOf looks up every user, whatever maxResults is",
+			in: &v1beta1.Input{
+				QueryType:  "UserMemberOf",
+				Users:      []*string{strPtr("a@example.com"), strPtr("b@example.com")},
+				MaxResults: intPtr(1),
+			},
+			results: map[string]interface{}{
+				"a@example.com": map[string]interface{}{"userPrincipalName": "a@example.com", "groups": []interface{}{}},
+			},
+			want: want{missing: []string{"b@example.com"}},
+		},
+		"GroupMembership": {
+			reason: "Queries that do not look up a list of names should never report missing names",
+			in: &v1beta1.Input{
+				QueryType: "GroupMembership",
+				Group:     strPtr("Developers"),
+			},
+			results: []interface{}{},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			missing, unqueried := missingNames(tc.in, tc.results)
+			if diff := cmp.Diff(tc.want.missing, missing, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("%s\nmissingNames(...): -want missing, +got missing:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.unqueried, unqueried, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("%s\nmissingNames(...): -want unqueried, +got unqueried:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
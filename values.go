@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/microsoft/kiota-abstractions-go/store"
+)
+
+// The helpers below convert optional Microsoft Graph model values into plain
+// result values, so that results can be written to both status and context.
+
+// optionalString returns the string pointed to, or nil
+func optionalString(s *string) interface{} {
+	if s == nil {
+		return nil
+	}
+	return *s
+}
+
+// optionalBool returns the bool pointed to, or nil
+func optionalBool(b *bool) interface{} {
+	if b == nil {
+		return nil
+	}
+	return *b
+}
+
+// optionalUUID returns the string form of the UUID pointed to, or nil
+func optionalUUID(u *uuid.UUID) interface{} {
+	if u == nil {
+		return nil
+	}
+	return u.String()
+}
+
+// optionalTime returns the RFC 3339 form of the time pointed to, or nil
+func optionalTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// stringList returns the strings as a list of result values
+func stringList(values []string) []interface{} {
+	list := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		list = append(list, v)
+	}
+	return list
+}
+
+// selectedValues returns the selected properties of a model, read from its
+// backing store. Properties are matched case-insensitively, including those
+// the model has no field for, such as directory extensions, and a property
+// that was not returned is nil. Without fields, every property is returned.
+func selectedValues(model store.BackedModel, fields []string) map[string]interface{} {
+	properties := make(map[string]interface{})
+	values := model.GetBackingStore().Enumerate()
+	if additionalData, ok := values["additionalData"].(map[string]interface{}); ok {
+		for key, value := range additionalData {
+			properties[key] = value
+		}
+	}
+	for key, value := range values {
+		if key != "additionalData" && key != "odataType" {
+			properties[key] = value
+		}
+	}
+
+	results := make(map[string]interface{})
+	if len(fields) == 0 {
+		for key, value := range properties {
+			results[key] = storeValue(value)
+		}
+		return results
+	}
+
+	byName := make(map[string]string, len(properties))
+	for key := range properties {
+		byName[strings.ToLower(key)] = key
+	}
+	for _, field := range fields {
+		key, ok := byName[strings.ToLower(field)]
+		if !ok {
+			results[field] = nil
+			continue
+		}
+		results[key] = storeValue(properties[key])
+	}
+	return results
+}
+
+// storeValue converts a value held by the backing store of a model, such as a
+// pointer to a primitive, an enum, a UUID or a nested model, into a plain
+// result value
+func storeValue(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || (rv.Kind() == reflect.Ptr && rv.IsNil()) {
+		return nil
+	}
+	if model, ok := v.(store.BackedModel); ok {
+		return selectedValues(model, nil)
+	}
+	if rv.Kind() == reflect.Ptr {
+		return storeValue(rv.Elem().Interface())
+	}
+
+	switch value := v.(type) {
+	case time.Time:
+		return optionalTime(&value)
+	case []byte:
+		return base64.StdEncoding.EncodeToString(value)
+	case fmt.Stringer:
+		// Enums, UUIDs, dates and durations
+		return value.String()
+	}
+
+	switch rv.Kind() {
+	case reflect.Slice:
+		list := make([]interface{}, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			list = append(list, storeValue(rv.Index(i).Interface()))
+		}
+		return list
+	case reflect.Map:
+		values := make(map[string]interface{}, rv.Len())
+		for _, key := range rv.MapKeys() {
+			values[fmt.Sprint(key.Interface())] = storeValue(rv.MapIndex(key).Interface())
+		}
+		return values
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// queryWarningsKey is the context key of the queryWarnings collected for a query
+type queryWarningsKey struct{}
+
+// queryWarnings collects non-fatal problems found while running a query, such
+// as truncated results, so that they can be reported as Warning results.
+type queryWarnings struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+// withQueryWarnings returns a context that collects the warnings added while running a query
+func withQueryWarnings(ctx context.Context) (context.Context, *queryWarnings) {
+	w := &queryWarnings{}
+	return context.WithValue(ctx, queryWarningsKey{}, w), w
+}
+
+// addQueryWarning adds a warning to the context, if it collects warnings
+func addQueryWarning(ctx context.Context, format string, args ...interface{}) {
+	w, ok := ctx.Value(queryWarningsKey{}).(*queryWarnings)
+	if !ok {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.messages = append(w.messages, fmt.Sprintf(format, args...))
+}
+
+// addQueryWarnings adds previously collected warnings to the context, if it collects warnings
+func addQueryWarnings(ctx context.Context, warnings []string) {
+	for _, warning := range warnings {
+		addQueryWarning(ctx, "%s", warning)
+	}
+}
+
+// list returns the warnings collected so far
+func (w *queryWarnings) list() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.messages...)
+}